@@ -0,0 +1,82 @@
+package atomicwriter
+
+import (
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// NewAppender returns a Writer whose temporary file is seeded with the
+// destination's current content, so writes append to it and Close commits
+// old-plus-new atomically — the atomic-rename counterpart of O_APPEND.
+//
+// The seed uses the cheapest mechanism the filesystem offers: on
+// reflink-capable filesystems (btrfs, XFS) the existing content is cloned
+// into the temp file instantly without duplicating data, making
+// read-modify-write on multi-GB files near-instant for the unchanged
+// portion; otherwise copy_file_range, then a plain copy. A missing
+// destination seeds nothing, and the append degrades to a plain write.
+//
+// The seeded bytes count towards WithMaxBytes and progress reporting, but
+// do not pass through tees — those only observe what the caller writes.
+//
+// NewAppender is incompatible with options whose committed artifact must
+// describe the whole file, and returns an error when any of them is set:
+// the seed bypasses Write, so with WithGzip or WithCRCFooter the file
+// itself would be rejected by its readers, and with WithChecksumSidecar or
+// WithBlockChecksums the committed digests would cover only the appended
+// bytes while claiming to cover everything.
+func NewAppender(filename string, perm os.FileMode, opts ...Option) (*Writer, error) {
+	w, err := New(filename, perm, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if w.gzipOn || w.crcFooter || w.sidecarAlgo != "" || w.blockAlgo != "" {
+		w.Discard()
+		return nil, errors.New("cannot append with WithGzip, WithCRCFooter, WithChecksumSidecar or WithBlockChecksums")
+	}
+	src, err := os.Open(w.fn)
+	if errors.Is(err, fs.ErrNotExist) {
+		return w, nil
+	}
+	if err != nil {
+		w.Discard()
+		return nil, err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		w.Discard()
+		return nil, err
+	}
+	if err := seedFile(w.f, src, fi.Size()); err != nil {
+		w.Discard()
+		return nil, errors.Wrap(err, "seeding temp file from destination")
+	}
+	if _, err := w.f.Seek(0, io.SeekEnd); err != nil {
+		w.Discard()
+		return nil, err
+	}
+	w.written = fi.Size()
+	return w, nil
+}
+
+// seedFileCopy rewinds both files and copies src into dst with a pooled
+// buffer; the portable tail of seedFile's fallback chain.
+func seedFileCopy(dst, src *os.File) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := dst.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := dst.Truncate(0); err != nil {
+		return err
+	}
+	buf, release := getCopyBuf(0)
+	_, err := io.CopyBuffer(dst, src, buf)
+	release()
+	return err
+}
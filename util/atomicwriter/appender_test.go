@@ -0,0 +1,92 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAppender(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "journal.log")
+	require.NoError(t, os.WriteFile(fn, []byte("line 1\n"), 0o644))
+
+	w, err := NewAppender(fn, 0o644)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), w.written)
+	_, err = w.Write([]byte("line 2\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2\n", string(dt))
+
+	// the destination is untouched when an append is discarded
+	w, err = NewAppender(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("discarded\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "line 1\nline 2\n", string(dt))
+
+	// a missing destination degrades to a plain write
+	missing := filepath.Join(dir, "fresh.log")
+	w, err = NewAppender(missing, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("first\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err = os.ReadFile(missing)
+	require.NoError(t, err)
+	require.Equal(t, "first\n", string(dt))
+
+	// seeded bytes count towards the size budget
+	w, err = NewAppender(fn, 0o644, WithMaxBytes(10))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("over the limit"))
+	require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	require.NoError(t, w.Close())
+
+	// options that transform or frame the content, or commit a digest of
+	// it, cannot compose with a raw seed of the old bytes
+	for _, opt := range []Option{
+		WithGzip(),
+		WithCRCFooter(),
+		WithChecksumSidecar("sha256"),
+		WithBlockChecksums(1<<20, "sha256"),
+	} {
+		_, err = NewAppender(fn, 0o644, opt)
+		require.ErrorContains(t, err, "cannot append")
+	}
+}
+
+func TestSeedFile(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.Create(filepath.Join(dir, "src"))
+	require.NoError(t, err)
+	defer src.Close()
+	content := make([]byte, 128<<10)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	_, err = src.Write(content)
+	require.NoError(t, err)
+
+	dst, err := os.Create(filepath.Join(dir, "dst"))
+	require.NoError(t, err)
+	defer dst.Close()
+	require.NoError(t, seedFile(dst, src, int64(len(content))))
+
+	dt, err := os.ReadFile(dst.Name())
+	require.NoError(t, err)
+	require.Equal(t, content, dt)
+
+	if !cloneFile(dst, src) {
+		t.Skip("no reflink support on the test filesystem; only the fallback chain was exercised")
+	}
+}
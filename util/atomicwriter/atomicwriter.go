@@ -0,0 +1,1741 @@
+// Package atomicwriter provides utilities for writing files atomically by
+// staging content in a temporary file in the destination directory and
+// renaming it over the destination once the content is fully written.
+package atomicwriter
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	stderrors "errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// ErrSizeLimitExceeded is returned by Write once the cumulative number of
+// written bytes exceeds the limit configured with WithMaxBytes.
+var ErrSizeLimitExceeded = errors.New("size limit exceeded")
+
+// ErrNoInodes is returned by New when the filesystem the temporary file
+// would be created on has free bytes but no free inodes left, so operators
+// can distinguish inode exhaustion from ordinary out-of-space conditions.
+var ErrNoInodes = errors.New("no free inodes on filesystem")
+
+// ErrQuotaExceeded is reported (alongside the underlying EDQUOT) when a
+// write or commit fails because the user's disk quota is exhausted, which
+// needs different operator action than a full filesystem.
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+// ErrShortContent is returned by Close under WithRequireFullSize when fewer
+// bytes arrived than the size declared with WithSizeHint.
+var ErrShortContent = errors.New("content is shorter than the declared size")
+
+// ErrInodeChanged is returned by Close under WithExpectInode when the
+// destination no longer carries the expected device/inode pair, i.e. it was
+// replaced or removed by another writer since the caller last looked.
+var ErrInodeChanged = errors.New("destination inode changed")
+
+// ErrModeMismatch is returned by Close under WithAssertMode when the
+// committed destination's permission bits differ from the requested ones.
+var ErrModeMismatch = errors.New("destination mode does not match requested permissions")
+
+// ErrIsDirectory is returned when the destination of an atomic write is a
+// directory, whether it already was one at validation time or became one
+// between New and Close.
+var ErrIsDirectory = errors.New("destination is a directory")
+
+// ErrCommitAborted is returned by Close when a WithOnExisting callback
+// decided the destination must not be replaced.
+var ErrCommitAborted = errors.New("commit aborted by policy")
+
+// ErrDestDirRemoved is returned by Close when the destination's parent
+// directory disappeared between New and the commit rename, e.g. because a
+// concurrent cleanup removed it out from under the writer.
+var ErrDestDirRemoved = errors.New("destination directory was removed")
+
+// ErrInsufficientSpace is returned by New when WithPreflightSpaceCheck is
+// set and the destination filesystem has fewer free bytes than the
+// WithSizeHint declaration.
+var ErrInsufficientSpace = errors.New("insufficient free space on filesystem")
+
+// ErrInvalidMode is returned by New when the requested perm carries bits
+// that are not plain permission bits, such as os.ModeDir or os.ModeSymlink,
+// which Chmod would silently ignore or misapply.
+var ErrInvalidMode = errors.New("invalid file mode")
+
+// PathRewriter, when non-nil, is applied to every destination path before
+// validation and temp-file placement, as an interop seam for virtualized
+// path layouts (e.g. remapping /etc into a per-tenant overlay) without
+// touching every call site. The rewrite happens once, up front, so the
+// temporary file and the rename target land on the same rewritten
+// filesystem. It must be installed before writers are created and is not
+// synchronized; mutating it while writes are in flight is a race.
+var PathRewriter func(string) string
+
+// rewritePath applies PathRewriter when one is installed.
+func rewritePath(p string) string {
+	if PathRewriter != nil {
+		return PathRewriter(p)
+	}
+	return p
+}
+
+// Option configures a Writer created by New.
+type Option func(*Writer)
+
+// WithResolvedTempDir resolves the destination directory through
+// filepath.EvalSymlinks before creating the temporary file, so that the
+// temporary file ends up on the same filesystem as the real backing
+// directory of the destination. This avoids cross-device rename errors
+// (EXDEV) when the destination directory is a bind mount or a symlink to
+// another filesystem. If resolution fails, the destination directory is
+// used as-is.
+func WithResolvedTempDir() Option {
+	return func(w *Writer) {
+		w.resolveTempDir = true
+	}
+}
+
+// WithUnnamedTemp stages content in an unnamed O_TMPFILE inode instead of a
+// named temporary file, linking it into place on commit. This leaves no
+// .tmp-* leftovers even if the process crashes mid-write. It is only
+// effective on Linux filesystems that support O_TMPFILE; elsewhere the
+// writer silently falls back to the named temp file behavior.
+func WithUnnamedTemp() Option {
+	return func(w *Writer) {
+		w.unnamed = true
+	}
+}
+
+// WithSyncEvery makes the writer trickle data to disk every n written
+// bytes, so a multi-gigabyte write does not pile all of its dirty pages
+// into one massive stall at the final fsync. On Linux this uses
+// sync_file_range to start asynchronous writeback of completed ranges;
+// elsewhere it is a no-op. Close still performs a full fsync before the
+// rename to guarantee durability.
+func WithSyncEvery(n int64) Option {
+	return func(w *Writer) {
+		w.syncEvery = n
+	}
+}
+
+// WithMaxBytes makes Write fail with ErrSizeLimitExceeded once the
+// cumulative written bytes would exceed limit, so an unbounded or malicious
+// producer cannot fill the disk through the writer. The failure marks the
+// writer as broken: Close removes the temporary file and never renames it
+// over the destination.
+func WithMaxBytes(limit int64) Option {
+	return func(w *Writer) {
+		w.maxBytes = limit
+	}
+}
+
+// WithNoCleanup suppresses the removal of the temporary file when a write
+// or commit fails, leaving it on disk so another process can complete the
+// commit (multi-process hand-off pipelines). The caller then owns the
+// cleanup of the path reported by TempPath. It has no effect on the
+// O_TMPFILE fast path, where the staged inode has no name to hand off.
+func WithNoCleanup() Option {
+	return func(w *Writer) {
+		w.noCleanup = true
+	}
+}
+
+// WithSpaceRetry retries the sync and rename steps of Close a bounded
+// number of times when they fail with a transient ENOSPC, sleeping backoff
+// between attempts. Thin-provisioned volumes can briefly report ENOSPC
+// until background reclaim frees blocks, and failing hard there loses the
+// whole produced content. The user's Write stream is never retried.
+func WithSpaceRetry(attempts int, backoff time.Duration) Option {
+	return func(w *Writer) {
+		w.spaceRetries = attempts
+		w.spaceBackoff = backoff
+	}
+}
+
+// WithRenameRetry retries the final rename a bounded number of times when
+// it fails with a transient EBUSY, sleeping backoff between attempts.
+// overlayfs (ubiquitous in containers) can briefly return EBUSY when
+// renaming over a file whose upper/lower layers are being reconciled, and
+// the condition clears on its own. Each retry is logged through the
+// WithLogger hook if one is set.
+func WithRenameRetry(attempts int, backoff time.Duration) Option {
+	return func(w *Writer) {
+		w.renameRetries = attempts
+		w.renameBackoff = backoff
+	}
+}
+
+// WithOpenFlags ORs extra flags (e.g. O_DSYNC, O_DIRECT) into the open of
+// the temporary file. The writer falls back from fast paths that cannot
+// carry extra flags (O_TMPFILE, os.CreateTemp) to a plain unique-name
+// open, so the flags are honored on every path. Callers are responsible
+// for picking flags that make sense for a written-then-renamed temp file;
+// most want a dedicated option like WithODSync instead.
+func WithOpenFlags(flags int) Option {
+	return func(w *Writer) {
+		w.extraOpenFlags |= flags
+	}
+}
+
+// WithTee fans each Write out to tee in addition to the temporary file,
+// e.g. to feed a hash accumulator or progress meter. The option is
+// stackable; tees are invoked in the order they were supplied. A tee write
+// error is recorded as the writer's write error, so Close aborts the
+// commit.
+func WithTee(tee io.Writer) Option {
+	return func(w *Writer) {
+		w.tees = append(w.tees, teeTarget{w: tee})
+	}
+}
+
+// WithTeeBestEffort is like WithTee but ignores errors from the tee target,
+// for observers (progress output, debug streams) that must not be able to
+// abort the commit.
+func WithTeeBestEffort(tee io.Writer) Option {
+	return func(w *Writer) {
+		w.tees = append(w.tees, teeTarget{w: tee, bestEffort: true})
+	}
+}
+
+type teeTarget struct {
+	w          io.Writer
+	bestEffort bool
+}
+
+// WithLogger emits debug-level structured records at the writer's
+// lifecycle points (temp file creation, sync, rename, abort) for
+// slog-based observability. A nil logger disables logging; the hot write
+// path is unaffected either way.
+func WithLogger(l *slog.Logger) Option {
+	return func(w *Writer) {
+		w.logger = l
+	}
+}
+
+// WithRotate keeps a numbered history of the destination: before the final
+// rename, Close rotates name.2 -> name.3, name.1 -> name.2, name -> name.1
+// and so on, bounded by keep (the oldest copy is deleted). Every rotation
+// step is itself a rename so a crash can lose at most one history slot.
+func WithRotate(keep int) Option {
+	return func(w *Writer) {
+		w.rotateKeep = keep
+	}
+}
+
+// WithUniqueSuffixFunc supplies a caller-generated unique suffix for the
+// temporary file name (e.g. from a monotonic counter plus PID), so the
+// writer can do a single O_CREATE|O_EXCL open instead of os.CreateTemp's
+// random-name retry loop. On networked filesystems where create+stat
+// round-trips dominate, this cuts the per-file syscall count for bulk
+// writers. If the generated name collides, the writer falls back to
+// os.CreateTemp.
+func WithUniqueSuffixFunc(fn func() string) Option {
+	return func(w *Writer) {
+		w.suffixFn = fn
+	}
+}
+
+// WithTempNamer lets the caller generate the temporary file's name, for
+// filesystems with naming rules the default ".tmp-<base>XXXX" dotfile
+// scheme violates (object-storage gateways that reject leading dots,
+// length caps, charset limits). fn receives the directory the temp file is
+// created in and the destination's base name and returns a base name for
+// the temp file; the writer still performs the O_CREATE|O_EXCL create
+// itself and calls fn again on a collision, so fn should include a
+// varying component. The name must not contain a path separator — the
+// temp file has to stay in dir, on the same filesystem as the
+// destination, or the commit rename stops being atomic.
+func WithTempNamer(fn func(dir, base string) string) Option {
+	return func(w *Writer) {
+		w.tempNamer = fn
+	}
+}
+
+// WithDropCacheOnCommit hints the kernel to drop the written pages from
+// the page cache after the final fsync (posix_fadvise DONTNEED), so a
+// large blob that won't be read again soon does not evict hotter data.
+// Linux-only and best-effort; errors are ignored. This only helps
+// write-once-read-rarely workloads — for content that is read back right
+// after writing it is counterproductive.
+func WithDropCacheOnCommit() Option {
+	return func(w *Writer) {
+		w.dropCache = true
+	}
+}
+
+// WithCreationTime sets the committed file's creation time (crtime) after
+// the rename, for reproducible builds that care about all timestamp
+// fields. It uses setattrlist on Darwin and SetFileTime on Windows, and is
+// a documented no-op on Linux and the BSDs, where crtime is not settable
+// through public APIs.
+func WithCreationTime(t time.Time) Option {
+	return func(w *Writer) {
+		w.crtime = t
+	}
+}
+
+// WithTmpfsStaging stages content in a temporary file under dir (typically
+// a tmpfs) instead of the destination directory. On commit the staged
+// content is copied to a second temporary file in the destination directory,
+// synced, and renamed into place, so the final step is still an atomic
+// same-filesystem rename. The extra copy trades bandwidth for write latency:
+// on slow destination filesystems it concentrates the destination I/O into
+// one sequential copy plus a single fsync instead of spreading it across the
+// producer's write pattern. It takes precedence over WithUnnamedTemp, whose
+// link-into-place commit cannot cross filesystems.
+func WithTmpfsStaging(dir string) Option {
+	return func(w *Writer) {
+		w.stagingDir = dir
+	}
+}
+
+// WithSizeHint declares the expected total size of the content, when the
+// producer knows it up front (e.g. from a Content-Length header). It is
+// reported to WithProgress callbacks as the total and lets short transfers
+// be detected.
+func WithSizeHint(n int64) Option {
+	return func(w *Writer) {
+		w.sizeHint = n
+	}
+}
+
+// WithPreflightSpaceCheck makes New fail fast with ErrInsufficientSpace
+// when the filesystem the temp file lands on has fewer free bytes than the
+// WithSizeHint declaration, instead of discovering ENOSPC mid-write after
+// significant work producing the content. A no-op without a size hint (or
+// where free-space accounting is unavailable). The check is inherently
+// TOCTOU: other writers can consume the space between New and the write,
+// so mid-write ENOSPC stays possible — see WithSpaceRetry for handling
+// that.
+func WithPreflightSpaceCheck() Option {
+	return func(w *Writer) {
+		w.preflightSpace = true
+	}
+}
+
+// WithRequireFullSize makes Close fail with ErrShortContent when fewer
+// bytes were written than declared with WithSizeHint, aborting the commit.
+// Without it a short transfer — e.g. a ReadFrom whose source ends with
+// io.ErrUnexpectedEOF — still commits exactly the bytes that arrived, and
+// detecting the truncation is left to the caller.
+func WithRequireFullSize() Option {
+	return func(w *Writer) {
+		w.requireFullSize = true
+	}
+}
+
+// WithProgress calls fn as bytes flow to the temporary file, for progress
+// bars on large blob writes. total is the WithSizeHint value, or -1 when no
+// hint was given. Callbacks are throttled to once per progressInterval of
+// written data, plus a final call from Close, so per-byte overhead stays
+// negligible; fn must not write to the writer.
+func WithProgress(fn func(written, total int64)) Option {
+	return func(w *Writer) {
+		w.progress = fn
+	}
+}
+
+// progressInterval is the minimum number of bytes between two consecutive
+// WithProgress callbacks.
+const progressInterval = 64 << 10
+
+// WithAssertMode re-stats the destination after the commit rename and fails
+// with ErrModeMismatch if its effective permission bits differ from the
+// requested perm, e.g. because a restrictive ACL or an overlayfs quirk
+// altered them. Hardened environments prefer a loud failure over silently
+// wrong permissions. Note that by then the destination has already been
+// replaced; the error reports the policy violation, it does not roll back.
+func WithAssertMode() Option {
+	return func(w *Writer) {
+		w.assertMode = true
+	}
+}
+
+// WithChecksumSidecar makes Close also publish a name.<algo> sidecar file
+// next to the destination, containing the destination's digest in the
+// conventional "<hex>  <name>" checksum-tool format. The digest is computed
+// while the content streams through Write, so no second read pass is needed.
+// Supported algorithms are "sha256" and "sha512". The two files are not
+// committed in a single atomic step: the data file is renamed first and the
+// sidecar second, so a crash between the two can leave data without a
+// checksum, but never a checksum describing absent or stale data.
+func WithChecksumSidecar(algo string) Option {
+	return func(w *Writer) {
+		w.sidecarAlgo = algo
+	}
+}
+
+// newSidecarHash returns the hash for a sidecar algorithm name.
+func newSidecarHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, errors.Errorf("unsupported checksum sidecar algorithm %q", algo)
+}
+
+// WithCreateMode opens the temporary file with the destination's final
+// permission bits instead of a restrictive 0600 followed by a Chmod in
+// Close. The file then carries its final mode from the very first instant,
+// with one syscall fewer and no mode transition even under the temp name —
+// relevant when the write window is long and other processes may find the
+// temp file. The process umask applies at creation, exactly as it would for
+// a plain os.OpenFile with that mode.
+func WithCreateMode() Option {
+	return func(w *Writer) {
+		w.createMode = true
+	}
+}
+
+// WithCaseInsensitive tells the writer that the destination filesystem
+// folds case (the macOS and Windows defaults), so destination validation
+// also considers an existing entry whose name differs from the destination
+// only in case — otherwise a directory or symlink named foo.txt would slip
+// past validation of Foo.txt and break the commit rename. Callers that do
+// not know the filesystem up front can probe it with DetectCaseInsensitive.
+func WithCaseInsensitive() Option {
+	return func(w *Writer) {
+		w.caseInsensitive = true
+	}
+}
+
+// DetectCaseInsensitive reports whether the filesystem holding dir folds
+// case, by probing with a temporary file. It errs on the side of
+// case-sensitive: probe failures report false.
+func DetectCaseInsensitive(dir string) bool {
+	f, err := os.CreateTemp(dir, ".tmp-case-probe-abc")
+	if err != nil {
+		return false
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	fi1, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	fi2, err := os.Stat(filepath.Join(dir, strings.ToUpper(filepath.Base(f.Name()))))
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi1, fi2)
+}
+
+// WithPreCommit registers a hook that Close invokes after the temporary
+// file has been fully synced but before the rename makes it visible at the
+// destination. If the hook returns an error, the commit is aborted: the
+// temporary file is removed and the destination is left untouched. This
+// provides a two-phase-commit extension point, e.g. for recording intent in
+// an external index.
+func WithPreCommit(fn func(tempPath string) error) Option {
+	return func(w *Writer) {
+		w.preCommit = fn
+	}
+}
+
+// WithSpecialModeBits allows the setuid, setgid and sticky bits in the perm
+// passed to New, which validatePerm otherwise rejects alongside the
+// file-type bits. Privileged writers installing e.g. setuid helpers opt in
+// explicitly rather than every caller being able to request them by
+// accident.
+func WithSpecialModeBits() Option {
+	return func(w *Writer) {
+		w.specialBits = true
+	}
+}
+
+// WithoutValidation skips the destination checks New normally performs
+// (validateDestination's Lstat/Stat round trips), trusting the caller to
+// have validated the path up front. It is a deliberate performance escape
+// hatch for tight loops writing many files into a known-good directory,
+// and removes the safety net with it: a destination that is a device, a
+// dangling symlink or missing its parent directory is no longer rejected
+// early, and Existed reports false regardless of the destination. Failures
+// those checks would have caught surface later, from the temp-file
+// creation or the commit rename.
+func WithoutValidation() Option {
+	return func(w *Writer) {
+		w.skipValidation = true
+	}
+}
+
+// WithRecreateDir recreates the destination's parent directory with the
+// given mode (via MkdirAll) and retries the rename once when the commit
+// finds the directory removed, instead of failing with ErrDestDirRemoved.
+// This absorbs the race where a concurrent garbage collection removes a
+// directory out from under a long-lived writer. Note the temp file lives
+// in the removed directory too on most configurations, so the retry mainly
+// helps writers staging elsewhere (WithTmpfsStaging) or racing a removal
+// that happened after the temp file was already flushed.
+func WithRecreateDir(perm os.FileMode) Option {
+	return func(w *Writer) {
+		w.recreateDir = true
+		w.recreateDirPerm = perm
+	}
+}
+
+// WithTempSubdir stages the temporary file in the named subdirectory of
+// the destination directory instead of next to the destination, so
+// inotify-sensitive watchers of that directory never see a .tmp-* sibling
+// appear — only the final rename up into it. The subdirectory stays on the
+// same filesystem, keeping the commit a plain rename, and is created with
+// 0700 if missing; after a successful commit it is removed again if empty.
+// A hidden name like ".atomicwriter-tmp" is the intended use.
+func WithTempSubdir(name string) Option {
+	return func(w *Writer) {
+		w.tempSubdir = name
+	}
+}
+
+// WithDurableMode applies the destination mode with fchmod on the
+// still-open temporary file before the final fsync, so the permission
+// change is covered by the same sync as the content. The default ordering
+// (sync, close, chmod, rename) leaves the chmod un-synced, and a crash
+// right after the commit can surface the file with the temporary file's
+// 0600 mode; callers whose readers rely on the mode being present opt into
+// the stricter ordering here.
+func WithDurableMode() Option {
+	return func(w *Writer) {
+		w.durableMode = true
+	}
+}
+
+// WithPostCommit registers a hook that Close invokes with the destination
+// path after the rename (and the parent-directory fsync making it durable)
+// succeeded, e.g. to signal a daemon to reload the file it just replaced.
+// An error from the hook is returned from Close, but the commit is NOT
+// rolled back: the destination already holds the new content, and the
+// caller only learns that the follow-up action failed. A nil fn is ignored.
+func WithPostCommit(fn func(path string) error) Option {
+	return func(w *Writer) {
+		w.postCommit = fn
+	}
+}
+
+// Action is the decision a WithOnExisting callback returns for a pending
+// commit.
+type Action int
+
+const (
+	// Overwrite proceeds with the commit, replacing the destination.
+	Overwrite Action = iota
+	// Skip abandons the staged content and leaves the destination
+	// untouched; Close returns nil.
+	Skip
+	// Abort abandons the staged content and makes Close fail with
+	// ErrCommitAborted.
+	Abort
+)
+
+// WithOnExisting registers a programmable overwrite policy: right before
+// the commit rename, fn is handed the destination's FileInfo (nil if the
+// destination does not exist) and decides whether to Overwrite, Skip or
+// Abort. The destination is stat-ed exactly once, and the same FileInfo is
+// passed to the callback, so the policy and the writer agree on what was
+// observed. A single callback subsumes exclusive-create, skip-if-unchanged
+// and mtime-comparison policies. Note the inherent TOCTOU window: the
+// destination can still change between the callback's decision and the
+// rename; use WithExpectInode when that window matters.
+func WithOnExisting(fn func(existing os.FileInfo) (Action, error)) Option {
+	return func(w *Writer) {
+		w.onExisting = fn
+	}
+}
+
+// Writer is an io.WriteCloser that writes to a temporary file in the
+// destination directory and atomically renames it over the destination on
+// Close. If a write fails, Close removes the temporary file instead of
+// touching the destination. Writing and closing concurrently is not
+// supported.
+type Writer struct {
+	f        *os.File
+	fn       string
+	writeErr error
+	closed   bool
+	perm     os.FileMode
+	// written counts the bytes successfully written to the temporary file.
+	// It is int64 so that files larger than 2GB are accounted for correctly
+	// on 32-bit platforms.
+	written int64
+
+	resolveTempDir  bool
+	unnamed         bool
+	noCleanup       bool
+	preCommit       func(tempPath string) error
+	onExisting      func(existing os.FileInfo) (Action, error)
+	postCommit      func(path string) error
+	audit           io.Writer
+	specialBits     bool
+	gzipOn          bool
+	crcFooter       bool
+	durableMode     bool
+	skipValidation  bool
+	tempSubdir      string
+	selinuxLabel    string
+	selinuxFromDir  bool
+	updateAllLinks  bool
+	extraOpenFlags  int
+	odsync          bool
+	fileLock        bool
+	lockf           *os.File
+	blockSize       int
+	blockAlgo       string
+	blocks          *blockAccumulator
+	limiter         *rate.Limiter
+	ctx             context.Context
+	fsType          FSType
+	recreateDir     bool
+	recreateDirPerm os.FileMode
+	gzw             io.WriteCloser
+	tees            []teeTarget
+	syncEvery       int64
+	lastSync        int64
+	maxBytes        int64
+	spaceRetries    int
+	spaceBackoff    time.Duration
+	renameRetries   int
+	renameBackoff   time.Duration
+	copyBufSize     int
+	logger          *slog.Logger
+	rotateKeep      int
+	suffixFn        func() string
+	tempNamer       func(dir, base string) string
+	dropCache       bool
+	crtime          time.Time
+	stagingDir      string
+	caseInsensitive bool
+	sidecarAlgo     string
+	sidecarHash     hash.Hash
+	assertMode      bool
+	sizeHint        int64
+	requireFullSize bool
+	preflightSpace  bool
+	overlayOpt      bool
+	expectInode     bool
+	createMode      bool
+	expectDev       uint64
+	expectIno       uint64
+	progress        func(written, total int64)
+	lastProgress    int64
+
+	// fsync, rename and statDest are seams for tests to inject transient
+	// failures or divergent filesystem behavior; when nil the real syscalls
+	// are used.
+	fsync    func(f *os.File) error
+	rename   func(oldpath, newpath string) error
+	chmod    func(name string, mode os.FileMode) error
+	statDest func(name string) (os.FileInfo, error)
+
+	// tmpDir is the directory the temporary file was created in, isUnnamed
+	// records whether the O_TMPFILE fast path is in effect for the current
+	// destination, and existed records whether the destination existed at
+	// New (or Reset) time.
+	tmpDir    string
+	isUnnamed bool
+	existed   bool
+	null      bool
+}
+
+// New returns a Writer for filename. Writes go to a temporary file next to
+// the destination, and Close atomically moves it in place.
+//
+// The commit succeeds even while other processes hold the destination open:
+// the rename swaps the directory entry, not the open file, so an existing
+// reader keeps seeing the content it opened until it reopens the path. This
+// is the usual POSIX behavior; on Windows the same semantics are provided
+// by committing with MOVEFILE_REPLACE_EXISTING, provided the reader opened
+// the file with delete sharing (os.Open does; a reader that withheld
+// FILE_SHARE_DELETE still blocks the rename with a sharing violation).
+//
+// NOTE: the process umask is not taken into account for the destination
+// file's permissions.
+//
+// A perm of 0 means "inherit the default": no chmod is performed and the
+// destination keeps the temporary file's 0600 mode. An inaccessible 000
+// file is practically never what a zero value intends, so it cannot be
+// requested through perm; callers that really want it can chmod the
+// destination afterwards.
+func New(filename string, perm os.FileMode, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		perm: perm,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if err := validatePerm(perm, w.specialBits); err != nil {
+		return nil, err
+	}
+	if err := validateCopyBufSize(w.copyBufSize); err != nil {
+		return nil, err
+	}
+	if err := w.open(filename); err != nil {
+		w.releaseLock()
+		return nil, err
+	}
+	return w, nil
+}
+
+// validatePerm rejects perm values that carry file-type bits (ModeDir,
+// ModeSymlink, ModeDevice, ...) rather than plain permission bits. The
+// setuid/setgid/sticky bits are only accepted when the caller opted in via
+// WithSpecialModeBits.
+func validatePerm(perm os.FileMode, allowSpecial bool) error {
+	allowed := fs.ModePerm
+	if allowSpecial {
+		allowed |= os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	}
+	if invalid := perm &^ allowed; invalid != 0 {
+		return errors.Wrapf(ErrInvalidMode, "mode %s carries non-permission bits %s", perm, invalid)
+	}
+	return nil
+}
+
+// open validates filename and creates the temporary file the writer stages
+// content in. It is used both by New and when resetting a writer for reuse.
+//
+// Every open path — os.CreateTemp, the O_EXCL fast path, the O_TMPFILE fast
+// path and the null device — produces a close-on-exec descriptor (the os
+// package sets O_CLOEXEC on all opens, and the raw O_TMPFILE open passes it
+// explicitly), so a temp file mid-write is never leaked into child processes
+// forked by a long-lived daemon.
+func (w *Writer) open(filename string) error {
+	filename = rewritePath(filename)
+	w.gzw = nil
+	if w.sidecarAlgo != "" {
+		if w.sidecarHash == nil {
+			h, err := newSidecarHash(w.sidecarAlgo)
+			if err != nil {
+				return err
+			}
+			w.sidecarHash = h
+			w.tees = append(w.tees, teeTarget{w: h})
+		} else {
+			w.sidecarHash.Reset()
+		}
+	}
+	if w.blockAlgo != "" {
+		if w.blocks == nil {
+			if w.blockSize <= 0 {
+				return errors.Errorf("invalid block size %d", w.blockSize)
+			}
+			h, err := newSidecarHash(w.blockAlgo)
+			if err != nil {
+				return err
+			}
+			w.blocks = &blockAccumulator{h: h, size: w.blockSize}
+			w.tees = append(w.tees, teeTarget{w: w.blocks})
+		} else {
+			w.blocks.reset()
+		}
+	}
+	if isNullDevice(filename) {
+		// "discard" destinations skip the temp-file/rename dance entirely,
+		// so configurable destinations can be pointed at the null device
+		f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			return err
+		}
+		w.f = f
+		w.fn = filename
+		w.null = true
+		w.writeErr = nil
+		w.closed = false
+		w.written = 0
+		w.lastSync = 0
+		w.lastProgress = 0
+		return nil
+	}
+	w.null = false
+	existed, err := w.validate(filename)
+	if err != nil {
+		return err
+	}
+	w.existed = existed
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if err := w.acquireLock(abspath); err != nil {
+		return err
+	}
+	w.fsType = fsTypeOf(filepath.Dir(abspath))
+	if w.overlayOpt {
+		if upper, ok := w.overlayUpperPath(abspath); ok {
+			// stage and commit in the upper layer; w.fsType now reflects
+			// the filesystem backing it
+			abspath = upper
+			w.fsType = fsTypeOf(filepath.Dir(abspath))
+		}
+	}
+	dir := filepath.Dir(abspath)
+	if w.resolveTempDir {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+	}
+	if w.stagingDir != "" {
+		dir = w.stagingDir
+	}
+	if w.tempSubdir != "" && w.stagingDir == "" {
+		dir = filepath.Join(dir, w.tempSubdir)
+		if err := os.Mkdir(dir, 0o700); err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	if err := checkFreeInodes(dir); err != nil {
+		return err
+	}
+	if w.preflightSpace && w.sizeHint > 0 {
+		if free, ok := freeBytes(dir); ok && free < uint64(w.sizeHint) {
+			return errors.Wrapf(ErrInsufficientSpace, "%d bytes free in %s, size hint is %d", free, dir, w.sizeHint)
+		}
+	}
+	w.isUnnamed = false
+	var f *os.File
+	if w.unnamed && w.stagingDir == "" && w.extraOpenFlags == 0 && w.tempNamer == nil {
+		mode := os.FileMode(0o600)
+		if w.createMode && w.perm != 0 {
+			mode = w.perm
+		}
+		if uf, err := openUnnamedTemp(dir, mode); err == nil {
+			f = uf
+			w.isUnnamed = true
+		}
+	}
+	tempMode := os.FileMode(0o600)
+	if w.createMode && w.perm != 0 {
+		tempMode = w.perm
+	}
+	openFlags := os.O_RDWR | os.O_CREATE | os.O_EXCL | w.extraOpenFlags
+	if f == nil && w.tempNamer != nil {
+		for range 10000 {
+			name := w.tempNamer(dir, filepath.Base(filename))
+			if name != filepath.Base(name) || name == "" {
+				return errors.Errorf("temp namer returned invalid name %q", name)
+			}
+			tf, err := os.OpenFile(filepath.Join(dir, name), openFlags, tempMode)
+			if err == nil {
+				f = tf
+				break
+			}
+			if !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		}
+		if f == nil {
+			return errors.Errorf("could not create temp file in %s: too many collisions", dir)
+		}
+	}
+	if f == nil && w.suffixFn != nil {
+		name := filepath.Join(dir, ".tmp-"+filepath.Base(filename)+"-"+w.suffixFn())
+		tf, err := os.OpenFile(name, openFlags, tempMode)
+		if err == nil {
+			f = tf
+		} else if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		// on collision fall through to the retry loop below
+	}
+	if f == nil && (w.createMode || w.extraOpenFlags != 0) {
+		// os.CreateTemp offers no way to pick the mode or extra open
+		// flags, so run our own unique-name loop
+		for range 10000 {
+			name := filepath.Join(dir, fmt.Sprintf(".tmp-%s-%d-%d", filepath.Base(filename), os.Getpid(), rootTempSeq.Add(1)))
+			tf, err := os.OpenFile(name, openFlags, tempMode)
+			if err == nil {
+				f = tf
+				break
+			}
+			if !errors.Is(err, fs.ErrExist) {
+				return err
+			}
+		}
+		if f == nil {
+			return errors.Errorf("could not create temp file in %s: too many collisions", dir)
+		}
+	}
+	if f == nil {
+		var err error
+		f, err = os.CreateTemp(dir, ".tmp-"+filepath.Base(filename))
+		if err != nil {
+			return err
+		}
+	}
+	hideTempFile(f.Name())
+	w.f = f
+	w.fn = abspath
+	w.tmpDir = dir
+	w.writeErr = nil
+	w.closed = false
+	w.written = 0
+	w.lastSync = 0
+	w.lastProgress = 0
+	if w.logger != nil {
+		w.logger.Debug("atomicwriter: created temp file", "dest", w.fn, "temp", f.Name(), "unnamed", w.isUnnamed)
+	}
+	return nil
+}
+
+// Reset reinitializes a closed writer for a new destination, re-running
+// destination validation and creating a fresh temporary file while keeping
+// the configured options. It returns an error if the writer has not been
+// closed yet.
+func (w *Writer) Reset(filename string) error {
+	if !w.closed {
+		return errors.New("cannot reset a writer that has not been closed")
+	}
+	return w.open(filename)
+}
+
+// WriteFile atomically writes data to a file named by filename and with the
+// specified permission bits. The target file is only replaced if the whole
+// write succeeds.
+func WriteFile(filename string, data []byte, perm os.FileMode, opts ...Option) error {
+	_, err := WriteFileResult(filename, data, perm, opts...)
+	return err
+}
+
+// Result describes a completed atomic write, for callers that want to feed
+// metrics or emit events without re-statting the destination.
+type Result struct {
+	// Path is the absolute path the content was committed to.
+	Path string
+	// BytesWritten is the number of bytes written to the destination.
+	BytesWritten int64
+	// Replaced reports whether the write replaced an existing file, as
+	// opposed to creating a new one.
+	Replaced bool
+	// Duration is the total time the write took, including the final sync
+	// and rename.
+	Duration time.Duration
+}
+
+// WriteFileResult is WriteFile with an additional Result describing the
+// completed write. The Result is only meaningful when the returned error is
+// nil.
+func WriteFileResult(filename string, data []byte, perm os.FileMode, opts ...Option) (Result, error) {
+	start := time.Now()
+	w, err := New(filename, perm, opts...)
+	if err != nil {
+		return Result{}, err
+	}
+	n, err := w.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+		w.writeErr = err
+	}
+	if err1 := w.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Path:         w.fn,
+		BytesWritten: w.written,
+		Replaced:     w.existed,
+		Duration:     time.Since(start),
+	}, nil
+}
+
+func (w *Writer) Write(dt []byte) (int, error) {
+	if w.maxBytes > 0 && w.written+int64(len(dt)) > w.maxBytes {
+		w.writeErr = ErrSizeLimitExceeded
+		return 0, w.wrapErr(ErrSizeLimitExceeded, "write")
+	}
+	if w.limiter != nil {
+		if err := w.waitRate(len(dt)); err != nil {
+			w.writeErr = err
+			return 0, w.wrapErr(err, "rate limit")
+		}
+	}
+	n, err := w.content().Write(dt)
+	w.written += int64(n)
+	if err != nil {
+		w.writeErr = err
+		return n, w.wrapErr(err, "write")
+	}
+	for _, tee := range w.tees {
+		if _, err := tee.w.Write(dt[:n]); err != nil && !tee.bestEffort {
+			w.writeErr = err
+			return n, w.wrapErr(err, "tee write")
+		}
+	}
+	if w.syncEvery > 0 && w.written-w.lastSync >= w.syncEvery {
+		// best-effort writeback; errors here do not fail the write, the
+		// final fsync in Close catches real I/O problems
+		syncFileRange(w.f, w.lastSync, w.written-w.lastSync)
+		w.lastSync = w.written
+	}
+	if w.progress != nil && w.written-w.lastProgress >= progressInterval {
+		w.reportProgress()
+	}
+	return n, nil
+}
+
+// reportProgress invokes the WithProgress callback with the current byte
+// count and the size hint (or -1 when none was given).
+func (w *Writer) reportProgress() {
+	total := w.sizeHint
+	if total <= 0 {
+		total = -1
+	}
+	w.progress(w.written, total)
+	w.lastProgress = w.written
+}
+
+// ReadFrom implements io.ReaderFrom by streaming r through Write, so
+// io.Copy into the writer keeps all configured options (size limits, tees,
+// progress, incremental sync) in effect.
+func (w *Writer) ReadFrom(r io.Reader) (int64, error) {
+	buf, release := getCopyBuf(w.copyBufSize)
+	defer release()
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			wn, werr := w.Write(buf[:n])
+			total += int64(wn)
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// String implements fmt.Stringer so logs that print the writer immediately
+// show what it is writing.
+func (w *Writer) String() string {
+	return fmt.Sprintf("atomicwriter to %s (temp %s)", w.fn, w.f.Name())
+}
+
+// wrapErr annotates err with the destination being written, so failures
+// deep in a call stack identify their target. Quota errors additionally
+// match ErrQuotaExceeded, so callers need not know the EDQUOT errno.
+func (w *Writer) wrapErr(err error, op string) error {
+	if isQuotaErr(err) {
+		err = stderrors.Join(ErrQuotaExceeded, err)
+	}
+	return errors.Wrapf(err, "atomic write to %s: %s failed", w.fn, op)
+}
+
+// BytesWritten returns the number of bytes successfully written to the
+// temporary file so far.
+func (w *Writer) BytesWritten() int64 {
+	return w.written
+}
+
+// TempPath returns the path of the temporary file the writer stages
+// content in, e.g. for handing it off to an external committer together
+// with WithNoCleanup.
+func (w *Writer) TempPath() string {
+	return w.f.Name()
+}
+
+// Publish atomically publishes the content accumulated so far to the
+// destination while the writer remains usable for further writes. It syncs
+// the temporary file, copies it to a snapshot, and renames the snapshot
+// over the destination. A hardlink is deliberately not used because it
+// would share the inode with the temporary file and expose later writes
+// non-atomically, so each call costs a full copy of the current content
+// plus a rename. Close performs the final publish as usual. It returns the
+// destination path the snapshot was published to.
+//
+// Publish is incompatible with WithGzip and WithCRCFooter and returns an
+// error when either is set: the gzip stream is only terminated and the
+// footer only appended at Close, so an intermediate snapshot would be a
+// truncated gzip stream or a file OpenVerified rejects.
+func (w *Writer) Publish() (string, error) {
+	if w.closed {
+		return "", errors.New("cannot publish on a closed writer")
+	}
+	if w.writeErr != nil {
+		return "", errors.Wrap(w.writeErr, "cannot publish after a failed write")
+	}
+	if w.gzipOn || w.crcFooter {
+		return "", errors.New("cannot publish intermediate snapshots with WithGzip or WithCRCFooter")
+	}
+	if err := w.f.Sync(); err != nil {
+		return "", err
+	}
+	snap, err := os.CreateTemp(w.tmpDir, ".tmp-snap-"+filepath.Base(w.fn))
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(snap.Name())
+		}
+	}()
+	// copy through a section reader so the writer's own offset is untouched
+	if _, err = io.Copy(snap, io.NewSectionReader(w.f, 0, w.written)); err != nil {
+		snap.Close()
+		return "", err
+	}
+	if err = snap.Close(); err != nil {
+		return "", err
+	}
+	if w.perm != 0 {
+		if err = os.Chmod(snap.Name(), w.perm); err != nil {
+			return "", err
+		}
+	}
+	// SyncRename fsyncs the snapshot and the destination's parent directory,
+	// matching the durability of the final commit in Close
+	if err = SyncRename(snap.Name(), w.fn); err != nil {
+		return "", err
+	}
+	return w.fn, nil
+}
+
+// CloseTo commits like Close but to dest instead of the destination
+// supplied to New, re-running destination validation on dest. This enables
+// content-addressed naming schemes where the final name is only known once
+// the content has been written, e.g. derived from its hash. dest must be on
+// the same filesystem as the temporary file so the commit rename stays
+// atomic.
+func (w *Writer) CloseTo(dest string) error {
+	if w.closed {
+		return errors.New("writer is already closed")
+	}
+	dest = rewritePath(dest)
+	existed, err := w.validate(dest)
+	if err != nil {
+		return err
+	}
+	w.existed = existed
+	abspath, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+	if ok, err := sameFilesystem(w.tmpDir, filepath.Dir(abspath)); err == nil && !ok && w.stagingDir == "" {
+		return errors.Errorf("cannot commit to %s: not on the same filesystem as the temporary file", dest)
+	}
+	w.fn = abspath
+	return w.Close()
+}
+
+// sameFilesystem reports whether both directories live on the same device.
+// On platforms without device numbers it reports true.
+func sameFilesystem(dir1, dir2 string) (bool, error) {
+	fi1, err := os.Stat(dir1)
+	if err != nil {
+		return false, err
+	}
+	fi2, err := os.Stat(dir2)
+	if err != nil {
+		return false, err
+	}
+	dev1, _, err := DevIno(fi1)
+	if err != nil {
+		return true, nil
+	}
+	dev2, _, err := DevIno(fi2)
+	if err != nil {
+		return true, nil
+	}
+	return dev1 == dev2, nil
+}
+
+// Close commits the staged content; it is an alias for Commit, retained
+// for io.WriteCloser compatibility.
+func (w *Writer) Close() error {
+	return w.Commit()
+}
+
+// Discard abandons the staged content: the temporary file is closed and
+// removed, and the destination is never touched. This is the explicit
+// "chose not to commit" operation, as opposed to the implicit abort Commit
+// performs after a failed write.
+func (w *Writer) Discard() error {
+	if w.closed {
+		return errors.New("writer is already closed")
+	}
+	w.closed = true
+	w.releaseLock()
+	err := w.f.Close()
+	if w.null || w.isUnnamed {
+		return err
+	}
+	if rmErr := os.Remove(w.f.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// Commit flushes and closes the temporary file, and renames it over the
+// destination unless a write failed, in which case the temporary file is
+// removed and the destination is left untouched. Content written so far is
+// committed even if empty: a writer that never saw a Write produces an
+// empty destination file.
+func (w *Writer) Commit() (retErr error) {
+	w.closed = true
+	defer w.releaseLock()
+	if w.progress != nil && w.writeErr == nil {
+		w.reportProgress()
+	}
+	if w.requireFullSize && w.writeErr == nil && w.sizeHint > 0 && w.written < w.sizeHint {
+		err := w.wrapErr(errors.Wrapf(ErrShortContent, "wrote %d of %d declared bytes", w.written, w.sizeHint), "commit")
+		w.writeErr = ErrShortContent
+		w.f.Close()
+		if !w.isUnnamed && !w.null && !w.noCleanup {
+			os.Remove(w.f.Name())
+		}
+		return err
+	}
+	if w.gzw != nil && w.writeErr == nil {
+		// flush the trailing gzip blocks and footer before the sync
+		if err := w.gzw.Close(); err != nil {
+			w.writeErr = err
+			w.f.Close()
+			if !w.isUnnamed && !w.null && !w.noCleanup {
+				os.Remove(w.f.Name())
+			}
+			return w.wrapErr(err, "gzip flush")
+		}
+	}
+	if w.crcFooter && w.writeErr == nil && !w.null {
+		if err := w.writeCRCFooter(); err != nil {
+			w.writeErr = err
+			w.f.Close()
+			if !w.isUnnamed && !w.noCleanup {
+				os.Remove(w.f.Name())
+			}
+			return w.wrapErr(err, "crc footer")
+		}
+	}
+	if w.null {
+		return w.f.Close()
+	}
+	if w.isUnnamed {
+		return w.closeUnnamed()
+	}
+	defer func() {
+		if (retErr != nil || w.writeErr != nil) && !w.noCleanup {
+			os.Remove(w.f.Name())
+		}
+	}()
+	if w.durableMode && w.writeErr == nil && !w.createMode {
+		if err := w.applyModeDurable(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	syncStart := time.Now()
+	if err := w.withSpaceRetry(func() error { return w.doSync(w.f) }); err != nil {
+		w.f.Close()
+		return w.wrapErr(err, "sync")
+	}
+	if w.logger != nil {
+		w.logger.Debug("atomicwriter: synced temp file", "dest", w.fn, "bytes", w.written, "duration", time.Since(syncStart))
+	}
+	if w.dropCache {
+		fadviseDontNeed(w.f)
+	}
+	if err := w.f.Close(); err != nil {
+		return w.wrapErr(err, "close")
+	}
+	src := w.f.Name()
+	if w.writeErr == nil && w.stagingDir != "" {
+		copied, err := w.copyFromStaging()
+		if err != nil && w.recreateDir && w.destDirRemoved(err) {
+			// staging kept the content out of the removed directory, so
+			// recreating it lets the commit proceed
+			if mkErr := os.MkdirAll(filepath.Dir(w.fn), w.recreateDirPerm); mkErr == nil {
+				copied, err = w.copyFromStaging()
+			}
+		}
+		if err != nil {
+			if w.destDirRemoved(err) {
+				return w.wrapErr(errors.Wrapf(ErrDestDirRemoved, "%s", filepath.Dir(w.fn)), "copy from staging")
+			}
+			return w.wrapErr(err, "copy from staging")
+		}
+		src = copied
+		defer func() {
+			if retErr != nil && !w.noCleanup {
+				os.Remove(src)
+			}
+		}()
+	}
+	// the mode was already applied before the sync under WithDurableMode,
+	// unless staging rewrote the file in the destination directory
+	if !w.createMode && !(w.durableMode && w.stagingDir == "") {
+		if err := w.applyMode(src); err != nil {
+			return err
+		}
+	}
+	if w.writeErr == nil {
+		if err := w.applySELinux(src); err != nil {
+			return w.wrapErr(err, "selinux label")
+		}
+		if w.preCommit != nil {
+			if err := w.preCommit(src); err != nil {
+				return w.wrapErr(err, "pre-commit hook")
+			}
+		}
+		return w.renameCommit(src)
+	}
+	if w.logger != nil {
+		w.logger.Debug("atomicwriter: aborted due to failed write", "dest", w.fn, "error", w.writeErr)
+	}
+	return nil
+}
+
+// renameCommit renames the staged file over the destination, mapping the
+// opaque EISDIR/ENOTDIR class of failures to ErrIsDirectory when the
+// destination turned into a directory between New and commit (TOCTOU).
+func (w *Writer) doSync(f *os.File) error {
+	if w.odsync && f == w.f && !w.fsType.weakSyncSemantics() {
+		// the temp file is open with O_DSYNC: every write already reached
+		// stable storage, and an explicit fsync would only serialize a
+		// second, empty flush. Other files synced through this seam (the
+		// staging-directory copy, snapshots) do not carry the flag, and on
+		// 9p/virtiofs O_DSYNC itself cannot be trusted to reach the host.
+		return nil
+	}
+	if w.fsync != nil {
+		return w.fsync(f)
+	}
+	return f.Sync()
+}
+
+func (w *Writer) doRename(oldpath, newpath string) error {
+	if w.rename != nil {
+		return w.rename(oldpath, newpath)
+	}
+	return osRename(oldpath, newpath)
+}
+
+func (w *Writer) doChmod(name string, mode os.FileMode) error {
+	if w.chmod != nil {
+		return w.chmod(name, mode)
+	}
+	return os.Chmod(name, mode)
+}
+
+// applyMode chmods the staged file to the destination mode, tolerating
+// filesystems that do not implement permissions at all (FAT and friends,
+// common on removable media), where chmod fails with ENOTSUP, EINVAL or
+// EPERM. The tolerance is limited to this step: permission errors from the
+// sync and rename steps still abort the commit.
+func (w *Writer) applyMode(src string) error {
+	if w.perm == 0 {
+		return nil
+	}
+	err := w.doChmod(src, w.perm)
+	if err == nil {
+		return nil
+	}
+	if isPermUnsupportedErr(err) {
+		if w.logger != nil {
+			w.logger.Debug("atomicwriter: filesystem does not support chmod, continuing", "dest", w.fn, "error", err)
+		}
+		return nil
+	}
+	if w.destDirRemoved(err) {
+		// the temp file went with the directory; nothing left to commit
+		return w.wrapErr(errors.Wrapf(ErrDestDirRemoved, "%s", filepath.Dir(w.fn)), "chmod")
+	}
+	return w.wrapErr(err, "chmod")
+}
+
+// applyModeDurable is applyMode through the still-open file descriptor,
+// used by WithDurableMode to get the permission change in front of the
+// final fsync. It shares applyMode's tolerance for filesystems without
+// permission support.
+func (w *Writer) applyModeDurable() error {
+	if w.perm == 0 {
+		return nil
+	}
+	err := w.f.Chmod(w.perm)
+	if err == nil {
+		return nil
+	}
+	if isPermUnsupportedErr(err) {
+		if w.logger != nil {
+			w.logger.Debug("atomicwriter: filesystem does not support chmod, continuing", "dest", w.fn, "error", err)
+		}
+		return nil
+	}
+	return w.wrapErr(err, "fchmod")
+}
+
+// destDirRemoved reports whether err from a commit step means the
+// destination's parent directory vanished: the operation failed with
+// ENOENT (or ESTALE on network filesystems) and the directory is indeed
+// gone.
+func (w *Writer) destDirRemoved(err error) bool {
+	if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, syscall.ESTALE) {
+		return false
+	}
+	_, statErr := os.Lstat(filepath.Dir(w.fn))
+	return errors.Is(statErr, fs.ErrNotExist)
+}
+
+// isPermUnsupportedErr reports whether err looks like "this filesystem has
+// no notion of permission bits" rather than a real access problem.
+func isPermUnsupportedErr(err error) bool {
+	return errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.EPERM)
+}
+
+func (w *Writer) doStatDest(name string) (os.FileInfo, error) {
+	if w.statDest != nil {
+		return w.statDest(name)
+	}
+	return os.Lstat(name)
+}
+
+// withSpaceRetry runs op, retrying it on transient ENOSPC up to the
+// configured number of attempts.
+func (w *Writer) withSpaceRetry(op func() error) error {
+	err := op()
+	for i := 0; i < w.spaceRetries && errors.Is(err, syscall.ENOSPC); i++ {
+		time.Sleep(w.spaceBackoff)
+		err = op()
+	}
+	return err
+}
+
+// withBusyRetry runs op, retrying it on transient EBUSY up to the number
+// of attempts configured with WithRenameRetry.
+func (w *Writer) withBusyRetry(op func() error) error {
+	err := op()
+	for i := 0; i < w.renameRetries && errors.Is(err, syscall.EBUSY); i++ {
+		if w.logger != nil {
+			w.logger.Debug("atomicwriter: rename returned EBUSY, retrying", "dest", w.fn, "attempt", i+1)
+		}
+		time.Sleep(w.renameBackoff)
+		err = op()
+	}
+	return err
+}
+
+// copyFromStaging copies the staged file into a temporary file in the
+// destination directory and syncs it, returning the copy's path. The staged
+// file is removed on success.
+func (w *Writer) copyFromStaging() (string, error) {
+	sf, err := os.Open(w.f.Name())
+	if err != nil {
+		return "", err
+	}
+	defer sf.Close()
+	df, err := os.CreateTemp(filepath.Dir(w.fn), ".tmp-"+filepath.Base(w.fn))
+	if err != nil {
+		return "", err
+	}
+	buf, release := getCopyBuf(w.copyBufSize)
+	if _, err := io.CopyBuffer(df, sf, buf); err != nil {
+		release()
+		df.Close()
+		os.Remove(df.Name())
+		return "", err
+	}
+	release()
+	if err := w.withSpaceRetry(func() error { return w.doSync(df) }); err != nil {
+		df.Close()
+		os.Remove(df.Name())
+		return "", err
+	}
+	if err := df.Close(); err != nil {
+		os.Remove(df.Name())
+		return "", err
+	}
+	os.Remove(w.f.Name())
+	return df.Name(), nil
+}
+
+func (w *Writer) renameCommit(src string) error {
+	unhideTempFile(src)
+	if w.onExisting != nil {
+		fi, err := w.doStatDest(w.fn)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return w.wrapErr(err, "stat destination")
+			}
+			fi = nil
+		}
+		action, err := w.onExisting(fi)
+		if err != nil {
+			return w.wrapErr(err, "on-existing policy")
+		}
+		switch action {
+		case Overwrite:
+		case Skip:
+			if !w.noCleanup {
+				os.Remove(src)
+			}
+			return nil
+		case Abort:
+			return w.wrapErr(ErrCommitAborted, "on-existing policy")
+		default:
+			return w.wrapErr(errors.Errorf("invalid action %d", action), "on-existing policy")
+		}
+	}
+	if w.expectInode {
+		fi, err := w.doStatDest(w.fn)
+		if err != nil {
+			return w.wrapErr(errors.Wrap(ErrInodeChanged, "destination is gone"), "inode check")
+		}
+		dev, ino, err := DevIno(fi)
+		if err != nil {
+			return w.wrapErr(err, "inode check")
+		}
+		if dev != w.expectDev || ino != w.expectIno {
+			return w.wrapErr(ErrInodeChanged, "inode check")
+		}
+	}
+	var err error
+	rewrote := false
+	if w.updateAllLinks {
+		if fi, statErr := w.doStatDest(w.fn); statErr == nil && fileNlink(fi) > 1 {
+			if err := w.rewriteInPlace(src); err != nil {
+				return w.wrapErr(err, "in-place update")
+			}
+			rewrote = true
+		}
+	}
+	if !rewrote {
+		if w.rotateKeep > 0 {
+			if err := w.rotate(); err != nil {
+				return w.wrapErr(err, "rotate")
+			}
+		}
+		err = w.withBusyRetry(func() error {
+			return w.withSpaceRetry(func() error { return w.doRename(src, w.fn) })
+		})
+	}
+	if err != nil && w.destDirRemoved(err) {
+		dir := filepath.Dir(w.fn)
+		if w.recreateDir {
+			if mkErr := os.MkdirAll(dir, w.recreateDirPerm); mkErr == nil {
+				err = w.withBusyRetry(func() error {
+					return w.withSpaceRetry(func() error { return w.doRename(src, w.fn) })
+				})
+			}
+		}
+		if err != nil {
+			return w.wrapErr(errors.Wrapf(ErrDestDirRemoved, "%s", dir), "rename")
+		}
+	}
+	if err == nil {
+		// make the rename itself durable, not just the file's content
+		if err := syncDir(filepath.Dir(w.fn)); err != nil {
+			return w.wrapErr(err, "sync parent directory")
+		}
+		if w.logger != nil {
+			w.logger.Debug("atomicwriter: committed", "dest", w.fn, "bytes", w.written)
+		}
+		if w.assertMode {
+			fi, err := w.doStatDest(w.fn)
+			if err != nil {
+				return w.wrapErr(err, "mode assertion")
+			}
+			if fi.Mode().Perm() != w.perm.Perm() {
+				return w.wrapErr(errors.Wrapf(ErrModeMismatch, "got %s, want %s", fi.Mode().Perm(), w.perm.Perm()), "mode assertion")
+			}
+		}
+		if w.sidecarHash != nil {
+			// data first, checksum second: a crash in between leaves data
+			// without a checksum, never a checksum for absent data
+			sum := fmt.Sprintf("%x  %s\n", w.sidecarHash.Sum(nil), filepath.Base(w.fn))
+			if err := WriteFile(w.fn+"."+w.sidecarAlgo, []byte(sum), w.perm); err != nil {
+				return w.wrapErr(err, "checksum sidecar")
+			}
+		}
+		if w.blocks != nil {
+			// same ordering rationale as the checksum sidecar
+			if err := WriteFile(w.fn+".blocks", w.blocks.manifest(w.blockAlgo), w.perm); err != nil {
+				return w.wrapErr(err, "block manifest")
+			}
+		}
+		if !w.crtime.IsZero() {
+			if err := setCreationTime(w.fn, w.crtime); err != nil {
+				return err
+			}
+		}
+		if w.tempSubdir != "" {
+			// best-effort: the staging subdirectory disappears once no
+			// other writer is using it
+			os.Remove(w.tmpDir)
+		}
+		if w.audit != nil {
+			w.writeAudit()
+		}
+		if w.postCommit != nil {
+			if err := w.postCommit(w.fn); err != nil {
+				return errors.Wrap(err, "post-commit hook")
+			}
+		}
+		return nil
+	}
+	if w.logger != nil {
+		w.logger.Debug("atomicwriter: rename failed", "dest", w.fn, "error", err)
+	}
+	if fi, err1 := os.Lstat(w.fn); err1 == nil && fi.IsDir() {
+		return w.wrapErr(ErrIsDirectory, "rename")
+	}
+	return w.wrapErr(err, "rename")
+}
+
+// Stat returns the os.Lstat of the committed destination, e.g. to obtain
+// the device and inode the atomic write produced (see DevIno) for building
+// a dedup layer on top of this package. It must be called after a
+// successful Close.
+func (w *Writer) Stat() (os.FileInfo, error) {
+	if !w.closed {
+		return nil, errors.New("cannot stat destination before Close")
+	}
+	if w.writeErr != nil {
+		return nil, errors.New("destination was not committed due to a failed write")
+	}
+	return os.Lstat(w.fn)
+}
+
+// isNullDevice reports whether filename refers to the OS null device
+// (/dev/null, or NUL on Windows), which callers use to mean "discard".
+func isNullDevice(filename string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filename, "NUL")
+	}
+	return filename == os.DevNull
+}
+
+// Existed reports whether the destination already existed when the writer
+// was created (or last reset), so callers can emit "created" vs "updated"
+// events without a redundant stat.
+func (w *Writer) Existed() bool {
+	return w.existed
+}
+
+// rotate shifts the destination's numbered history by one slot, deleting
+// the oldest copy. Missing slots are skipped.
+func (w *Writer) rotate() error {
+	if err := os.Remove(fmt.Sprintf("%s.%d", w.fn, w.rotateKeep)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for i := w.rotateKeep - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", w.fn, i), fmt.Sprintf("%s.%d", w.fn, i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(w.fn, w.fn+".1"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ValidateAll validates many destination paths up front so a large
+// generation job can fail fast before producing anything. Parent directory
+// stats are cached, turning an N-stat pre-flight into one stat per shared
+// directory. All invalid destinations are reported, joined into a single
+// error.
+func ValidateAll(filenames []string) error {
+	dirCache := map[string]error{}
+	var errs []error
+	for _, fn := range filenames {
+		if isNullDevice(fn) {
+			continue
+		}
+		if _, err := validateDestination(fn); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		dir := filepath.Dir(fn)
+		dirErr, ok := dirCache[dir]
+		if !ok {
+			fi, err := os.Stat(dir)
+			switch {
+			case err != nil:
+				dirErr = errors.Wrap(err, "invalid destination directory")
+			case !fi.IsDir():
+				dirErr = errors.Errorf("destination parent %s is not a directory", dir)
+			}
+			dirCache[dir] = dirErr
+		}
+		if dirErr != nil {
+			errs = append(errs, errors.Wrapf(dirErr, "destination %s", fn))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// validate runs destination validation with the writer's case-folding
+// configuration: on case-insensitive filesystems an entry whose name differs
+// from the destination only in case is the destination, so its type is
+// checked and it counts as existing.
+func (w *Writer) validate(filename string) (bool, error) {
+	if w.skipValidation {
+		return false, nil
+	}
+	existed, err := validateDestination(filename)
+	if err != nil || existed || !w.caseInsensitive {
+		return existed, err
+	}
+	if real, ok := caseFoldLookup(filename); ok {
+		return validateDestination(real)
+	}
+	return false, nil
+}
+
+// caseFoldLookup scans the destination's parent directory for an entry whose
+// name matches the destination's base name under case folding, and returns
+// its path.
+func caseFoldLookup(filename string) (string, bool) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		if strings.EqualFold(e.Name(), base) {
+			return filepath.Join(dir, e.Name()), true
+		}
+	}
+	return "", false
+}
+
+// validateDestination rejects destinations that an atomic rename cannot
+// replace safely, such as directories and symbolic links, and reports
+// whether the destination already exists. Non-existing destinations are
+// valid.
+func validateDestination(filename string) (exists bool, _ error) {
+	if filename == "" {
+		return false, errors.New("file name is empty")
+	}
+	fi, err := os.Lstat(filename)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, errors.Wrap(err, "failed to stat destination")
+	case fi.IsDir():
+		return true, errors.Wrapf(ErrIsDirectory, "cannot write to %s", filename)
+	case fi.Mode()&os.ModeSymlink != 0:
+		return true, errors.Errorf("cannot write to a symbolic link directly: %s", filename)
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// syncFileRange starts asynchronous writeback of [off, off+n) so dirty
+// pages trickle to disk before the final fsync. Errors are ignored by the
+// caller; filesystems that do not support it simply fall back to the final
+// fsync.
+func syncFileRange(f *os.File, off, n int64) {
+	unix.SyncFileRange(int(f.Fd()), off, n, unix.SYNC_FILE_RANGE_WRITE)
+}
+
+// fadviseDontNeed hints the kernel to drop the file's cached pages.
+// Best-effort: errors are ignored.
+func fadviseDontNeed(f *os.File) {
+	unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
+
+// cloneFile attempts to reflink src into dst via FICLONE and reports
+// whether it succeeded. On failure the caller falls back to a plain copy.
+func cloneFile(dst, src *os.File) bool {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd())) == nil
+}
+
+// seedFile copies src's current content (size bytes) into the empty dst as
+// cheaply as the filesystem allows: a reflink (FICLONE) shares the blocks
+// instantly, copy_file_range keeps the copy in the kernel, and a buffered
+// copy is the last resort.
+func seedFile(dst, src *os.File, size int64) error {
+	if cloneFile(dst, src) {
+		return nil
+	}
+	remain := size
+	for remain > 0 {
+		n, err := unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, int(remain), 0)
+		if err != nil || n == 0 {
+			break
+		}
+		remain -= int64(n)
+	}
+	if remain == 0 {
+		return nil
+	}
+	// copy_file_range unsupported or interrupted: rewind and copy the lot
+	return seedFileCopy(dst, src)
+}
+
+// openUnnamedTemp opens an unnamed temporary file in dir using O_TMPFILE.
+// The file has no directory entry, so nothing is left behind if the process
+// crashes before commit. It returns an error on filesystems that do not
+// support O_TMPFILE, in which case the caller falls back to os.CreateTemp.
+func openUnnamedTemp(dir string, mode os.FileMode) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, uint32(mode.Perm()))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
+	}
+	return os.NewFile(uintptr(fd), dir), nil
+}
+
+// closeUnnamed commits an unnamed (O_TMPFILE) temporary file. linkat refuses
+// to overwrite an existing name, so the file is first linked to a temporary
+// name and then renamed over the destination.
+func (w *Writer) closeUnnamed() (retErr error) {
+	if w.writeErr != nil {
+		// nothing to clean up on disk; the inode disappears with the fd
+		return w.f.Close()
+	}
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if w.dropCache {
+		fadviseDontNeed(w.f)
+	}
+	tmp := filepath.Join(w.tmpDir, fmt.Sprintf(".tmp-%s-%d-%d", filepath.Base(w.fn), os.Getpid(), w.f.Fd()))
+	err := unix.Linkat(unix.AT_FDCWD, fmt.Sprintf("/proc/self/fd/%d", w.f.Fd()), unix.AT_FDCWD, tmp, unix.AT_SYMLINK_FOLLOW)
+	if err1 := w.f.Close(); err == nil && err1 != nil {
+		err = err1
+	}
+	if err != nil {
+		return w.wrapErr(err, "link")
+	}
+	defer func() {
+		if retErr != nil {
+			os.Remove(tmp)
+		}
+	}()
+	if !w.createMode {
+		if err := w.applyMode(tmp); err != nil {
+			return err
+		}
+	}
+	if w.preCommit != nil {
+		if err := w.preCommit(tmp); err != nil {
+			return w.wrapErr(err, "pre-commit hook")
+		}
+	}
+	return w.renameCommit(tmp)
+}
@@ -0,0 +1,178 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/selinux/go-selinux"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithUnnamedTemp(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644, WithUnnamedTemp())
+	require.NoError(t, err)
+	if !w.isUnnamed {
+		t.Skip("O_TMPFILE not supported on this filesystem")
+	}
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// the staged content must not be visible in the directory
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// overwrite works even though linkat refuses to replace names
+	require.NoError(t, WriteFile(fn, []byte("updated"), 0o644, WithUnnamedTemp()))
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "updated", string(dt))
+}
+
+func TestWithSyncEvery(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644, WithSyncEvery(8))
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		_, err = w.Write([]byte("0123456789"))
+		require.NoError(t, err)
+	}
+	require.Equal(t, int64(40), w.lastSync)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Len(t, dt, 40)
+}
+
+func TestWithDropCacheOnCommit(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "blob.bin")
+
+	require.NoError(t, WriteFile(fn, make([]byte, 1<<20), 0o644, WithDropCacheOnCommit()))
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Len(t, dt, 1<<20)
+}
+
+func BenchmarkWriteFileSyncEvery(b *testing.B) {
+	dir := b.TempDir()
+	fn := filepath.Join(dir, "bench.txt")
+	data := make([]byte, 64<<10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteFile(fn, data, 0o644, WithSyncEvery(16<<10)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteFile(b *testing.B) {
+	dir := b.TempDir()
+	fn := filepath.Join(dir, "bench.txt")
+	data := make([]byte, 64<<10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteFile(fn, data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriteFileUnnamedTemp(b *testing.B) {
+	dir := b.TempDir()
+	fn := filepath.Join(dir, "bench.txt")
+	data := make([]byte, 64<<10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteFile(fn, data, 0o644, WithUnnamedTemp()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTempFdCloexec(t *testing.T) {
+	dir := t.TempDir()
+
+	writers := map[string]*Writer{}
+	w, err := New(filepath.Join(dir, "named.txt"), 0o644)
+	require.NoError(t, err)
+	writers["named"] = w
+	w, err = New(filepath.Join(dir, "unnamed.txt"), 0o644, WithUnnamedTemp())
+	require.NoError(t, err)
+	writers["unnamed"] = w
+	w, err = New(os.DevNull, 0o644)
+	require.NoError(t, err)
+	writers["null"] = w
+
+	for name, w := range writers {
+		flags, err := unix.FcntlInt(w.f.Fd(), unix.F_GETFD, 0)
+		require.NoError(t, err, name)
+		require.NotZero(t, flags&unix.FD_CLOEXEC, "%s temp fd is missing FD_CLOEXEC", name)
+	}
+
+	// exec a child and verify none of the temp fds survive into it; fds
+	// keep their numbers across exec, so listing /proc/self/fd suffices
+	out, err := exec.Command("ls", "/proc/self/fd").Output()
+	require.NoError(t, err)
+	childFds := map[string]struct{}{}
+	for _, fd := range strings.Fields(string(out)) {
+		childFds[fd] = struct{}{}
+	}
+	for name, w := range writers {
+		_, inherited := childFds[fmt.Sprintf("%d", w.f.Fd())]
+		require.False(t, inherited, "%s temp fd leaked into the child", name)
+		require.NoError(t, w.Discard())
+	}
+}
+
+func TestWithSELinuxLabel(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "labeled.txt")
+
+	// the option is a declared no-op when SELinux is disabled, so commits
+	// must succeed either way
+	require.NoError(t, WriteFile(fn, []byte("hello"), 0o644, WithSELinuxLabel("system_u:object_r:etc_t:s0")))
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	if !selinux.GetEnabled() {
+		t.Skip("SELinux not enabled on this host")
+	}
+	label, err := selinux.FileLabel(fn)
+	require.NoError(t, err)
+	require.Equal(t, "system_u:object_r:etc_t:s0", label)
+
+	require.NoError(t, WriteFile(fn, []byte("hello"), 0o644, WithSELinuxFromDir()))
+	dirLabel, err := selinux.FileLabel(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, dirLabel)
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+
+package atomicwriter
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// syncFileRange is a no-op on platforms without sync_file_range; the final
+// fsync in Close still guarantees durability.
+func syncFileRange(f *os.File, off, n int64) {}
+
+// fadviseDontNeed is a no-op on platforms without posix_fadvise.
+func fadviseDontNeed(f *os.File) {}
+
+// cloneFile reports whether src could be reflinked into dst; reflinks are
+// only supported on linux, so the caller always falls back to a plain copy.
+func cloneFile(dst, src *os.File) bool {
+	return false
+}
+
+// seedFile copies src's current content into the empty dst; without
+// FICLONE and copy_file_range only the buffered copy remains.
+func seedFile(dst, src *os.File, size int64) error {
+	return seedFileCopy(dst, src)
+}
+
+var errUnnamedTempUnsupported = errors.New("unnamed temp files are only supported on linux")
+
+func openUnnamedTemp(dir string, mode os.FileMode) (*os.File, error) {
+	return nil, errUnnamedTempUnsupported
+}
+
+func (w *Writer) closeUnnamed() error {
+	return errUnnamedTempUnsupported
+}
@@ -0,0 +1,1348 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	err := WriteFile(fn, []byte("hello"), 0o644)
+	require.NoError(t, err)
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	// no leftover temp files
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestWriteFileInvalidDestination(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WriteFile("", []byte("x"), 0o644)
+	require.Error(t, err)
+
+	err = WriteFile(dir, []byte("x"), 0o644)
+	require.ErrorIs(t, err, ErrIsDirectory)
+
+	if runtime.GOOS != "windows" {
+		link := filepath.Join(dir, "link")
+		require.NoError(t, os.Symlink(filepath.Join(dir, "target"), link))
+		err = WriteFile(link, []byte("x"), 0o644)
+		require.ErrorContains(t, err, "symbolic link")
+	}
+}
+
+func TestReset(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(filepath.Join(dir, "a.txt"), 0o600)
+	require.NoError(t, err)
+
+	err = w.Reset(filepath.Join(dir, "b.txt"))
+	require.ErrorContains(t, err, "has not been closed")
+
+	_, err = w.Write([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.NoError(t, w.Reset(filepath.Join(dir, "b.txt")))
+	_, err = w.Write([]byte("second"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "first", string(dt))
+
+	dt, err = os.ReadFile(filepath.Join(dir, "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(dt))
+
+	fi, err := os.Stat(filepath.Join(dir, "b.txt"))
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	}
+}
+
+func TestBytesWritten(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(filepath.Join(dir, "test.txt"), 0o644)
+	require.NoError(t, err)
+	defer w.Close()
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, int64(5), w.BytesWritten())
+
+	// simulate a >4GB logical write to check that the counter does not
+	// wrap on 32-bit platforms
+	w.written = 5 << 30
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, int64(5<<30+5), w.BytesWritten())
+}
+
+func TestWithPreCommit(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	var hookPath string
+	err := WriteFile(fn, []byte("hello"), 0o644, WithPreCommit(func(tempPath string) error {
+		hookPath = tempPath
+		return nil
+	}))
+	require.NoError(t, err)
+	require.Contains(t, hookPath, ".tmp-")
+
+	// a failing hook aborts the commit and removes the temp file
+	err = WriteFile(fn, []byte("updated"), 0o644, WithPreCommit(func(string) error {
+		return errors.New("index write failed")
+	}))
+	require.ErrorContains(t, err, "index write failed")
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestPublish(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "monitor.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("step1\n"))
+	require.NoError(t, err)
+
+	published, err := w.Publish()
+	require.NoError(t, err)
+	require.Equal(t, fn, published)
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "step1\n", string(dt))
+
+	// keep writing; the published file must not change until the next publish
+	_, err = w.Write([]byte("step2\n"))
+	require.NoError(t, err)
+
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "step1\n", string(dt))
+
+	_, err = w.Publish()
+	require.NoError(t, err)
+
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "step1\nstep2\n", string(dt))
+
+	require.NoError(t, w.Close())
+
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "step1\nstep2\n", string(dt))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// gzip streams and CRC footers are only finalized at Close, so an
+	// intermediate snapshot of either would be corrupt
+	for _, opt := range []Option{WithGzip(), WithCRCFooter()} {
+		w, err = New(fn, 0o644, opt)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("snapshot\n"))
+		require.NoError(t, err)
+		_, err = w.Publish()
+		require.ErrorContains(t, err, "cannot publish intermediate snapshots")
+		require.NoError(t, w.Close())
+	}
+}
+
+func TestWriterString(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	defer w.Close()
+
+	s := w.String()
+	require.Contains(t, s, "atomicwriter to "+fn)
+	require.Contains(t, s, ".tmp-")
+}
+
+func TestErrorsCarryDestination(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	err := WriteFile(fn, []byte("x"), 0o644, WithPreCommit(func(string) error {
+		return errors.New("boom")
+	}))
+	require.ErrorContains(t, err, "atomic write to "+fn)
+	require.ErrorContains(t, err, "boom")
+}
+
+func TestStat(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+
+	_, err = w.Stat()
+	require.ErrorContains(t, err, "before Close")
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	fi, err := w.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(5), fi.Size())
+
+	if runtime.GOOS != "windows" {
+		dev, ino, err := DevIno(fi)
+		require.NoError(t, err)
+		require.NotZero(t, ino)
+		_ = dev
+	}
+}
+
+func TestCloseTo(t *testing.T) {
+	dir := t.TempDir()
+
+	w, err := New(filepath.Join(dir, "placeholder"), 0o644)
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	final := filepath.Join(dir, "by-content-hash.txt")
+	require.NoError(t, w.CloseTo(final))
+
+	dt, err := os.ReadFile(final)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	// the placeholder destination must not have been created
+	_, err = os.Stat(filepath.Join(dir, "placeholder"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = w.CloseTo(filepath.Join(dir, "other"))
+	require.ErrorContains(t, err, "already closed")
+}
+
+func TestWithMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+	require.NoError(t, WriteFile(fn, []byte("old"), 0o644))
+
+	w, err := New(fn, 0o644, WithMaxBytes(8))
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("12345"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("6789"))
+	require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	require.NoError(t, w.Close())
+
+	// the destination is untouched and the temp file removed
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(dt))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestDestinationBecomesDirectory(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	// swap the destination to a directory after New (TOCTOU)
+	require.NoError(t, os.Mkdir(fn, 0o755))
+
+	err = w.Close()
+	require.ErrorIs(t, err, ErrIsDirectory)
+	require.ErrorContains(t, err, fn)
+}
+
+func TestWithNoCleanup(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644, WithNoCleanup())
+	require.NoError(t, err)
+	tempPath := w.TempPath()
+	require.Contains(t, tempPath, ".tmp-")
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	err = w.CloseTo(filepath.Join(dir, "sub", "missing"))
+	require.Error(t, err)
+
+	// the temp file survives the failed commit for external hand-off
+	dt, err := os.ReadFile(tempPath)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+}
+
+func TestWithSpaceRetry(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644, WithSpaceRetry(3, time.Millisecond))
+	require.NoError(t, err)
+
+	// inject two transient ENOSPC failures on sync
+	var calls int
+	w.fsync = func(f *os.File) error {
+		calls++
+		if calls <= 2 {
+			return syscall.ENOSPC
+		}
+		return f.Sync()
+	}
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, 3, calls)
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	// without retries the same failure is fatal
+	w2, err := New(fn, 0o644)
+	require.NoError(t, err)
+	w2.fsync = func(*os.File) error { return syscall.ENOSPC }
+	_, err = w2.Write([]byte("x"))
+	require.NoError(t, err)
+	require.ErrorIs(t, w2.Close(), syscall.ENOSPC)
+}
+
+func TestExisted(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	require.False(t, w.Existed())
+	_, err = w.Write([]byte("v1"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	require.True(t, w.Existed())
+	_, err = w.Write([]byte("v2"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
+
+func TestWithTee(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	h := sha256.New()
+	var buf bytes.Buffer
+	err := WriteFile(fn, []byte("hello"), 0o644, WithTee(h), WithTee(&buf))
+	require.NoError(t, err)
+	require.Equal(t, "hello", buf.String())
+	want := sha256.Sum256([]byte("hello"))
+	require.Equal(t, want[:], h.Sum(nil))
+
+	// a failing tee aborts the commit
+	err = WriteFile(fn, []byte("updated"), 0o644, WithTee(failWriter{}))
+	require.ErrorContains(t, err, "tee failed")
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	// ...unless it is best-effort
+	err = WriteFile(fn, []byte("updated"), 0o644, WithTeeBestEffort(failWriter{}))
+	require.NoError(t, err)
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "updated", string(dt))
+}
+
+type failWriter struct{}
+
+func (failWriter) Write([]byte) (int, error) {
+	return 0, errors.New("tee failed")
+}
+
+func TestWithResolvedTempDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires symlinks")
+	}
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	require.NoError(t, os.Mkdir(real, 0o755))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(real, link))
+
+	fn := filepath.Join(link, "test.txt")
+	w, err := New(fn, 0o644, WithResolvedTempDir())
+	require.NoError(t, err)
+
+	// the temp file must live in the resolved directory
+	require.Equal(t, real, filepath.Dir(w.f.Name()))
+
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(filepath.Join(real, "test.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+}
+
+func TestWriteToNullDevice(t *testing.T) {
+	fn := os.DevNull
+	if runtime.GOOS == "windows" {
+		fn = "NUL"
+	}
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("discarded"))
+	require.NoError(t, err)
+	require.Equal(t, int64(9), w.BytesWritten())
+	require.NoError(t, w.Close())
+
+	// no temp files appear next to the null device
+	if runtime.GOOS != "windows" {
+		entries, err := os.ReadDir(filepath.Dir(os.DevNull))
+		require.NoError(t, err)
+		for _, e := range entries {
+			require.NotContains(t, e.Name(), ".tmp-null")
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	require.NoError(t, WriteFile(fn, []byte("hello"), 0o644, WithLogger(l)))
+
+	logs := buf.String()
+	require.Contains(t, logs, "created temp file")
+	require.Contains(t, logs, "synced temp file")
+	require.Contains(t, logs, "committed")
+
+	// nil logger is a no-op
+	require.NoError(t, WriteFile(fn, []byte("quiet"), 0o644, WithLogger(nil)))
+}
+
+func TestWithRotate(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "gen.conf")
+
+	for i, content := range []string{"v1", "v2", "v3", "v4"} {
+		require.NoError(t, WriteFile(fn, []byte(content), 0o644, WithRotate(2)), i)
+	}
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v4", string(dt))
+
+	dt, err = os.ReadFile(fn + ".1")
+	require.NoError(t, err)
+	require.Equal(t, "v3", string(dt))
+
+	dt, err = os.ReadFile(fn + ".2")
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(dt))
+
+	// v1 fell off the end of the bounded history
+	_, err = os.Stat(fn + ".3")
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithUniqueSuffixFunc(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	var counter int
+	suffix := func() string {
+		counter++
+		return fmt.Sprintf("%d-%d", os.Getpid(), counter)
+	}
+
+	w, err := New(fn, 0o644, WithUniqueSuffixFunc(suffix))
+	require.NoError(t, err)
+	require.Contains(t, w.TempPath(), fmt.Sprintf(".tmp-test.txt-%d-1", os.Getpid()))
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// a colliding suffix falls back to CreateTemp
+	blocked := filepath.Join(dir, ".tmp-test.txt-fixed")
+	require.NoError(t, os.WriteFile(blocked, nil, 0o600))
+	w, err = New(fn, 0o644, WithUniqueSuffixFunc(func() string { return "fixed" }))
+	require.NoError(t, err)
+	require.NotEqual(t, blocked, w.TempPath())
+	require.NoError(t, w.Close())
+}
+
+func BenchmarkNewUniqueSuffix(b *testing.B) {
+	dir := b.TempDir()
+	fn := filepath.Join(dir, "bench.txt")
+	var counter int
+	suffix := func() string {
+		counter++
+		return fmt.Sprintf("%d-%d", os.Getpid(), counter)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteFile(fn, []byte("data"), 0o644, WithUniqueSuffixFunc(suffix)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCommitAndDiscard(t *testing.T) {
+	dir := t.TempDir()
+
+	// write + Commit
+	fn := filepath.Join(dir, "committed.txt")
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Commit())
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(dt))
+
+	// no write + Commit produces an empty file
+	fn = filepath.Join(dir, "empty.txt")
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	require.NoError(t, w.Commit())
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Empty(t, dt)
+
+	// write + Discard leaves nothing behind
+	fn = filepath.Join(dir, "discarded.txt")
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+	_, err = os.Stat(fn)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// no write + Discard leaves nothing behind either
+	fn = filepath.Join(dir, "discarded-empty.txt")
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+	_, err = os.Stat(fn)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.ErrorContains(t, w.Discard(), "already closed")
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestValidateAll(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+
+	require.NoError(t, ValidateAll([]string{
+		filepath.Join(dir, "a.txt"),
+		filepath.Join(sub, "b.txt"),
+		filepath.Join(sub, "c.txt"),
+	}))
+
+	err := ValidateAll([]string{
+		filepath.Join(dir, "ok.txt"),
+		dir, // a directory
+		filepath.Join(dir, "missing", "d.txt"),
+		filepath.Join(dir, "missing", "e.txt"),
+	})
+	require.Error(t, err)
+	require.ErrorIs(t, err, ErrIsDirectory)
+	require.ErrorContains(t, err, "d.txt")
+	require.ErrorContains(t, err, "e.txt")
+}
+
+func TestWithCreationTime(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	crtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, WriteFile(fn, []byte("hello"), 0o644, WithCreationTime(crtime)))
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		fi, err := os.Stat(fn)
+		require.NoError(t, err)
+		// birthtime is only exposed through Sys(); just assert the write
+		// itself did not fail and the mtime is sane
+		require.False(t, fi.ModTime().IsZero())
+	}
+}
+
+func TestWriteFileResult(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "result.txt")
+
+	res, err := WriteFileResult(fn, []byte("first"), 0o644)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), res.BytesWritten)
+	require.False(t, res.Replaced)
+	require.Greater(t, res.Duration, time.Duration(0))
+	abs, err := filepath.Abs(fn)
+	require.NoError(t, err)
+	require.Equal(t, abs, res.Path)
+
+	res, err = WriteFileResult(fn, []byte("second"), 0o644)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), res.BytesWritten)
+	require.True(t, res.Replaced)
+}
+
+func TestWithTmpfsStaging(t *testing.T) {
+	staging := t.TempDir()
+	destDir := t.TempDir()
+	fn := filepath.Join(destDir, "staged.txt")
+
+	w, err := New(fn, 0o644, WithTmpfsStaging(staging))
+	require.NoError(t, err)
+	require.Equal(t, staging, filepath.Dir(w.TempPath()))
+
+	_, err = w.Write([]byte("staged content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "staged content", string(dt))
+
+	// neither the staging dir nor the destination dir keeps leftovers
+	for _, dir := range []string{staging, destDir} {
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		for _, e := range entries {
+			require.Equal(t, "staged.txt", e.Name())
+		}
+	}
+
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+}
+
+func TestWithCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+
+	// a directory that only matches the destination under case folding
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "foo.txt"), 0o755))
+	_, err := New(filepath.Join(dir, "Foo.txt"), 0o644, WithCaseInsensitive())
+	require.ErrorIs(t, err, ErrIsDirectory)
+
+	// without the hint the differently-cased entry is ignored
+	w, err := New(filepath.Join(dir, "Foo.txt"), 0o644)
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+
+	// a regular file under a different case counts as existing
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bar.txt"), []byte("x"), 0o644))
+	w, err = New(filepath.Join(dir, "Bar.txt"), 0o644, WithCaseInsensitive())
+	require.NoError(t, err)
+	require.True(t, w.Existed())
+	require.NoError(t, w.Discard())
+}
+
+func TestDetectCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+	ci := DetectCaseInsensitive(dir)
+	if runtime.GOOS == "linux" {
+		require.False(t, ci)
+	}
+	t.Logf("case-insensitive: %v", ci)
+}
+
+func TestWithChecksumSidecar(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "artifact.bin")
+
+	data := []byte("artifact content")
+	require.NoError(t, WriteFile(fn, data, 0o644, WithChecksumSidecar("sha256")))
+
+	dt, err := os.ReadFile(fn + ".sha256")
+	require.NoError(t, err)
+	want := fmt.Sprintf("%x  artifact.bin\n", sha256.Sum256(data))
+	require.Equal(t, want, string(dt))
+
+	_, err = New(fn, 0o644, WithChecksumSidecar("md5"))
+	require.ErrorContains(t, err, "unsupported checksum sidecar algorithm")
+}
+
+type modeFakingInfo struct {
+	os.FileInfo
+	mode os.FileMode
+}
+
+func (m modeFakingInfo) Mode() os.FileMode { return m.mode }
+
+func TestWithAssertMode(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "policy.txt")
+
+	// happy path: the real filesystem honors the requested mode
+	require.NoError(t, WriteFile(fn, []byte("x"), 0o640, WithAssertMode()))
+
+	// a filesystem that quietly diverges from the requested mode
+	w, err := New(fn, 0o640, WithAssertMode())
+	require.NoError(t, err)
+	w.statDest = func(name string) (os.FileInfo, error) {
+		fi, err := os.Lstat(name)
+		if err != nil {
+			return nil, err
+		}
+		return modeFakingInfo{FileInfo: fi, mode: 0o600}, nil
+	}
+	_, err = w.Write([]byte("y"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorIs(t, err, ErrModeMismatch)
+}
+
+func TestWithProgress(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "progress.bin")
+
+	type report struct{ written, total int64 }
+	var reports []report
+	fnProgress := func(written, total int64) {
+		reports = append(reports, report{written, total})
+	}
+
+	data := make([]byte, 3*progressInterval/2)
+	w, err := New(fn, 0o644, WithProgress(fnProgress), WithSizeHint(int64(len(data))))
+	require.NoError(t, err)
+	n, err := io.Copy(w, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.NoError(t, w.Close())
+
+	require.NotEmpty(t, reports)
+	last := reports[len(reports)-1]
+	require.Equal(t, int64(len(data)), last.written)
+	require.Equal(t, int64(len(data)), last.total)
+
+	// without a size hint the total is reported as -1
+	reports = nil
+	require.NoError(t, WriteFile(fn, []byte("tiny"), 0o644, WithProgress(fnProgress)))
+	require.Len(t, reports, 1)
+	require.Equal(t, report{4, -1}, reports[0])
+}
+
+type shortReader struct {
+	data []byte
+}
+
+func (r *shortReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadFromShortSource(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "short.bin")
+
+	// by default a short transfer surfaces the source error but the
+	// received bytes still commit
+	w, err := New(fn, 0o644, WithSizeHint(100))
+	require.NoError(t, err)
+	n, err := w.ReadFrom(&shortReader{data: []byte("partial")})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, int64(7), n)
+	require.NoError(t, w.Close())
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "partial", string(dt))
+
+	// WithRequireFullSize turns the short transfer into a commit failure
+	fn2 := filepath.Join(dir, "short2.bin")
+	w, err = New(fn2, 0o644, WithSizeHint(100), WithRequireFullSize())
+	require.NoError(t, err)
+	_, err = w.ReadFrom(&shortReader{data: []byte("partial")})
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	err = w.Close()
+	require.ErrorIs(t, err, ErrShortContent)
+	_, err = os.Stat(fn2)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1) // only the first committed file remains
+}
+
+func TestSyncRename(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, ".tmp-manual")
+	dst := filepath.Join(dir, "manual.txt")
+	require.NoError(t, os.WriteFile(tmp, []byte("content"), 0o644))
+
+	require.NoError(t, SyncRename(tmp, dst))
+
+	dt, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+	_, err = os.Stat(tmp)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	err = SyncRename(filepath.Join(dir, "missing"), dst)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithCreateMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "exact.txt")
+
+	w, err := New(fn, 0o640, WithCreateMode())
+	require.NoError(t, err)
+
+	// the temp file already carries the final mode; there is never a 0600
+	// window to observe
+	fi, err := os.Stat(w.TempPath())
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+
+	_, err = w.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	fi, err = os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+}
+
+func TestChmodUnsupportedFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "fatty.txt")
+
+	// a FAT-like filesystem rejecting chmod outright does not fail the write
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	w.chmod = func(name string, mode os.FileMode) error {
+		return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+	}
+	_, err = w.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "x", string(dt))
+
+	// a genuine access problem still surfaces
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	w.chmod = func(name string, mode os.FileMode) error {
+		return &os.PathError{Op: "chmod", Path: name, Err: syscall.EACCES}
+	}
+	_, err = w.Write([]byte("y"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorIs(t, err, syscall.EACCES)
+}
+
+func TestWriteFileZeroPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "zero.txt")
+
+	// perm 0 must not produce an inaccessible 000 file
+	require.NoError(t, WriteFile(fn, []byte("readable"), 0))
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "readable", string(dt))
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
+
+func TestWithRenameRetry(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "busy.txt")
+
+	w, err := New(fn, 0o644, WithRenameRetry(3, time.Millisecond))
+	require.NoError(t, err)
+	var calls int
+	w.rename = func(oldpath, newpath string) error {
+		calls++
+		if calls <= 2 {
+			return syscall.EBUSY
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, 3, calls)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+
+	// without the option a single EBUSY is fatal
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	w.rename = func(oldpath, newpath string) error {
+		return syscall.EBUSY
+	}
+	_, err = w.Write([]byte("other"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorIs(t, err, syscall.EBUSY)
+}
+
+func TestWithOnExisting(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "policy.txt")
+
+	// no destination yet: the callback sees nil and can let the write through
+	var sawNil bool
+	err := WriteFile(fn, []byte("v1"), 0o644, WithOnExisting(func(existing os.FileInfo) (Action, error) {
+		sawNil = existing == nil
+		return Overwrite, nil
+	}))
+	require.NoError(t, err)
+	require.True(t, sawNil)
+
+	// Skip leaves the destination untouched and Close succeeds
+	err = WriteFile(fn, []byte("v2"), 0o644, WithOnExisting(func(existing os.FileInfo) (Action, error) {
+		require.NotNil(t, existing)
+		return Skip, nil
+	}))
+	require.NoError(t, err)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(dt))
+
+	// Abort fails the commit with ErrCommitAborted
+	err = WriteFile(fn, []byte("v3"), 0o644, WithOnExisting(func(existing os.FileInfo) (Action, error) {
+		return Abort, nil
+	}))
+	require.ErrorIs(t, err, ErrCommitAborted)
+
+	// a callback error aborts the commit as-is
+	policyErr := errors.New("mtime too new")
+	err = WriteFile(fn, []byte("v3"), 0o644, WithOnExisting(func(existing os.FileInfo) (Action, error) {
+		return Overwrite, policyErr
+	}))
+	require.ErrorIs(t, err, policyErr)
+
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(dt))
+
+	// no temp files are left behind by skipped or aborted commits
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestWithPostCommit(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "reload.conf")
+
+	var gotPath string
+	err := WriteFile(fn, []byte("v1"), 0o644, WithPostCommit(func(path string) error {
+		gotPath = path
+		return nil
+	}))
+	require.NoError(t, err)
+	require.Equal(t, fn, gotPath)
+
+	// a hook failure surfaces from Close but the commit stands
+	hookErr := errors.New("reload signal failed")
+	err = WriteFile(fn, []byte("v2"), 0o644, WithPostCommit(func(path string) error {
+		return hookErr
+	}))
+	require.ErrorIs(t, err, hookErr)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(dt))
+
+	// the hook does not run when the commit is aborted
+	var ran bool
+	w, err := New(fn, 0o644, WithPostCommit(func(path string) error {
+		ran = true
+		return nil
+	}))
+	require.NoError(t, err)
+	w.fsync = func(f *os.File) error { return errors.New("sync failed") }
+	_, err = w.Write([]byte("v3"))
+	require.NoError(t, err)
+	require.Error(t, w.Close())
+	require.False(t, ran)
+
+	// a nil hook is ignored
+	require.NoError(t, WriteFile(fn, []byte("v3"), 0o644, WithPostCommit(nil)))
+}
+
+func TestValidatePerm(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "perm.txt")
+
+	for _, perm := range []os.FileMode{
+		os.ModeDir | 0o755,
+		os.ModeSymlink,
+		os.ModeDevice | 0o600,
+		os.ModeNamedPipe,
+		os.ModeSetuid | 0o755,
+		os.ModeSticky | 0o777,
+	} {
+		_, err := New(fn, perm)
+		require.ErrorIs(t, err, ErrInvalidMode, "perm %s", perm)
+	}
+
+	// plain permission bits are fine, and special bits pass with the opt-in
+	require.NoError(t, WriteFile(fn, []byte("x"), 0o644))
+	_, err := New(fn, os.ModeSetuid|0o755, WithSpecialModeBits())
+	require.NoError(t, err)
+	// the type bits stay rejected even with the opt-in
+	_, err = New(fn, os.ModeDir|0o755, WithSpecialModeBits())
+	require.ErrorIs(t, err, ErrInvalidMode)
+
+	// clean up the writer opened above
+	entries, err := filepath.Glob(filepath.Join(dir, ".tmp-*"))
+	require.NoError(t, err)
+	for _, e := range entries {
+		os.Remove(e)
+	}
+}
+
+func TestWithDurableMode(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "durable.txt")
+
+	// with the option, the mode is already on the temp file when the final
+	// fsync runs, so it is covered by the sync
+	w, err := New(fn, 0o640, WithDurableMode())
+	require.NoError(t, err)
+	var modeAtSync os.FileMode
+	w.fsync = func(f *os.File) error {
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		modeAtSync = fi.Mode().Perm()
+		return f.Sync()
+	}
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, os.FileMode(0o640), modeAtSync)
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+
+	// without it, the temp file still carries 0600 at sync time
+	w, err = New(fn, 0o640)
+	require.NoError(t, err)
+	w.fsync = func(f *os.File) error {
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		modeAtSync = fi.Mode().Perm()
+		return f.Sync()
+	}
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Equal(t, os.FileMode(0o600), modeAtSync)
+}
+
+func TestWithoutValidation(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "fast.txt")
+
+	// ordinary writes still work without the validation pass
+	require.NoError(t, WriteFile(fn, []byte("content"), 0o644, WithoutValidation()))
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+
+	// problems validation would have rejected early still fail, just later
+	err = WriteFile(filepath.Join(dir, "missing", "file.txt"), []byte("x"), 0o644, WithoutValidation())
+	require.Error(t, err)
+}
+
+func BenchmarkBulkWrite(b *testing.B) {
+	content := []byte("a small payload")
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "validated"},
+		{name: "without-validation", opts: []Option{WithoutValidation()}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			dir := b.TempDir()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := WriteFile(filepath.Join(dir, "file.txt"), content, 0o644, bench.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPathRewriter(t *testing.T) {
+	dir := t.TempDir()
+	overlay := filepath.Join(dir, "overlay")
+	require.NoError(t, os.Mkdir(overlay, 0o755))
+
+	PathRewriter = func(p string) string {
+		return filepath.Join(overlay, filepath.Base(p))
+	}
+	defer func() { PathRewriter = nil }()
+
+	// the write lands in the rewritten location, temp file included
+	require.NoError(t, WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0o644))
+	dt, err := os.ReadFile(filepath.Join(overlay, "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(dt))
+	_, err = os.Stat(filepath.Join(dir, "config.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// no temp files leaked outside the rewritten directory
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// write-set commits rewrite their target the same way
+	ws, err := NewWriteSet(overlay)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("asset.txt", []byte("a"), 0o644))
+	require.NoError(t, ws.Commit(filepath.Join(dir, "assets")))
+	_, err = os.Stat(filepath.Join(overlay, "assets", "asset.txt"))
+	require.NoError(t, err)
+}
+
+func TestWithTempSubdir(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "watched.txt")
+
+	w, err := New(fn, 0o644, WithTempSubdir(".atomicwriter-tmp"))
+	require.NoError(t, err)
+	// the temp file lives in the subdirectory, not next to the destination
+	require.Equal(t, filepath.Join(dir, ".atomicwriter-tmp"), filepath.Dir(w.f.Name()))
+	fi, err := os.Stat(filepath.Join(dir, ".atomicwriter-tmp"))
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	require.Equal(t, os.FileMode(0o700), fi.Mode().Perm())
+
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+
+	// the empty staging subdirectory was cleaned up after the commit
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "watched.txt", entries[0].Name())
+
+	// two writers share the subdirectory without tripping over each other
+	w1, err := New(fn, 0o644, WithTempSubdir(".atomicwriter-tmp"))
+	require.NoError(t, err)
+	w2, err := New(fn, 0o644, WithTempSubdir(".atomicwriter-tmp"))
+	require.NoError(t, err)
+	_, err = w1.Write([]byte("one"))
+	require.NoError(t, err)
+	_, err = w2.Write([]byte("two"))
+	require.NoError(t, err)
+	require.NoError(t, w1.Close())
+	require.NoError(t, w2.Close())
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "two", string(dt))
+}
+
+func TestDestDirRemoved(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "cache")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	fn := filepath.Join(sub, "entry.txt")
+
+	// the directory disappears between New and Close: the cryptic ENOENT
+	// becomes ErrDestDirRemoved naming the directory
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(sub))
+	err = w.Close()
+	require.ErrorIs(t, err, ErrDestDirRemoved)
+	require.ErrorContains(t, err, sub)
+}
+
+func TestWithRecreateDir(t *testing.T) {
+	dir := t.TempDir()
+	staging := filepath.Join(dir, "staging")
+	require.NoError(t, os.Mkdir(staging, 0o755))
+	sub := filepath.Join(dir, "cache")
+	require.NoError(t, os.Mkdir(sub, 0o755))
+	fn := filepath.Join(sub, "entry.txt")
+
+	// with staging the content survives the directory removal, and the
+	// recreate option lets the commit go through
+	w, err := New(fn, 0o644, WithTmpfsStaging(staging), WithRecreateDir(0o755))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll(sub))
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+	fi, err := os.Stat(sub)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+}
+
+func TestReplaceWithOpenReader(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(fn, []byte("old"), 0o644))
+
+	// a reader that opened the file before the replace keeps its view: the
+	// rename swaps the directory entry, not the open file. os.Open shares
+	// delete access on Windows, so the replace succeeds there too.
+	reader, err := os.Open(fn)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	require.NoError(t, WriteFile(fn, []byte("new"), 0o644))
+
+	dt, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(dt))
+
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(dt))
+}
+
+func TestWithTempNamer(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "data.json")
+
+	// a gateway-compliant scheme: no leading dot, bounded charset
+	var seq int
+	namer := func(dir, base string) string {
+		seq++
+		return fmt.Sprintf("tmp_%s_%d", base, seq)
+	}
+	w, err := New(fn, 0o644, WithTempNamer(namer))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "tmp_data.json_1"), w.f.Name())
+	_, err = w.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+
+	// collisions are retried by calling the namer again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tmp_data.json_2"), nil, 0o600))
+	w, err = New(fn, 0o644, WithTempNamer(namer))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "tmp_data.json_3"), w.f.Name())
+	require.NoError(t, w.Discard())
+
+	// names escaping the directory are rejected
+	_, err = New(fn, 0o644, WithTempNamer(func(dir, base string) string {
+		return filepath.Join("..", "escape")
+	}))
+	require.ErrorContains(t, err, "invalid name")
+}
+
+func TestWithPreflightSpaceCheck(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "big.bin")
+
+	if free, ok := freeBytes(dir); ok {
+		t.Logf("%d bytes free in %s", free, dir)
+	} else {
+		t.Skip("free-space accounting is unavailable on the test filesystem")
+	}
+
+	// a hint no filesystem can satisfy fails before a temp file is created
+	_, err := New(fn, 0o644, WithSizeHint(1<<62), WithPreflightSpaceCheck())
+	require.ErrorIs(t, err, ErrInsufficientSpace)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// a modest hint passes, as does the option without any hint
+	w, err := New(fn, 0o644, WithSizeHint(1), WithPreflightSpaceCheck())
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+	w, err = New(fn, 0o644, WithPreflightSpaceCheck())
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+}
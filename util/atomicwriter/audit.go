@@ -0,0 +1,57 @@
+package atomicwriter
+
+import (
+	"encoding/json"
+	"io"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// WithAuditLog emits one JSON line to sink for every successful commit,
+// recording when which path was replaced, by whom and with how many bytes,
+// for operators who need an append-only audit trail of file replacements.
+// Point it at a file opened with O_APPEND (or any io.Writer feeding an
+// audit pipeline); the caller owns synchronization if several writers share
+// one sink. The audit write is best-effort: a failure never fails the
+// commit that triggered it and is only reported through the WithLogger
+// hook.
+func WithAuditLog(sink io.Writer) Option {
+	return func(w *Writer) {
+		w.audit = sink
+	}
+}
+
+// auditRecord is the shape of one audit line.
+type auditRecord struct {
+	Time  time.Time `json:"time"`
+	Path  string    `json:"path"`
+	Bytes int64     `json:"bytes"`
+	User  string    `json:"user,omitempty"`
+}
+
+// currentUsername is resolved once; user lookups can be slow (NSS) and the
+// answer does not change over the process lifetime.
+var currentUsername = sync.OnceValue(func() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+})
+
+// writeAudit emits the audit line for a commit that just succeeded.
+func (w *Writer) writeAudit() {
+	dt, err := json.Marshal(auditRecord{
+		Time:  time.Now().UTC(),
+		Path:  w.fn,
+		Bytes: w.written,
+		User:  currentUsername(),
+	})
+	if err == nil {
+		_, err = w.audit.Write(append(dt, '\n'))
+	}
+	if err != nil && w.logger != nil {
+		w.logger.Debug("atomicwriter: audit write failed", "dest", w.fn, "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "tracked.txt")
+
+	var sink bytes.Buffer
+	require.NoError(t, WriteFile(fn, []byte("content"), 0o644, WithAuditLog(&sink)))
+	require.NoError(t, WriteFile(fn, []byte("more content"), 0o644, WithAuditLog(&sink)))
+
+	lines := bytes.Split(bytes.TrimSpace(sink.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var rec auditRecord
+	require.NoError(t, json.Unmarshal(lines[1], &rec))
+	require.Equal(t, fn, rec.Path)
+	require.Equal(t, int64(len("more content")), rec.Bytes)
+	require.WithinDuration(t, time.Now().UTC(), rec.Time, time.Minute)
+
+	// an aborted commit produces no audit line
+	w, err := New(fn, 0o644, WithAuditLog(&sink))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, w.Discard())
+	require.Len(t, bytes.Split(bytes.TrimSpace(sink.Bytes()), []byte("\n")), 2)
+
+	// a failing sink never fails the commit
+	require.NoError(t, WriteFile(fn, []byte("v3"), 0o644, WithAuditLog(failWriter{})))
+}
@@ -0,0 +1,39 @@
+package atomicwriter
+
+import (
+	"io"
+	"os"
+)
+
+// Backend is the subset of this package that higher layers typically
+// depend on, as an interface: callers that accept a Backend instead of
+// calling the package functions directly can be unit-tested with an
+// in-memory fake, or pointed at an entirely different store (an object
+// store, a remote agent) without changing their write paths.
+type Backend interface {
+	// New returns a writer that stages content for name and commits it
+	// atomically on Close.
+	New(name string, perm os.FileMode) (io.WriteCloser, error)
+	// WriteFile atomically writes data to name.
+	WriteFile(name string, data []byte, perm os.FileMode) error
+}
+
+// NewBackend returns the default Backend, backed by this package's
+// atomic writes to the local filesystem. opts apply to every write
+// performed through it.
+func NewBackend(opts ...Option) Backend {
+	return osBackend{opts: opts}
+}
+
+// osBackend adapts the package functions to the Backend interface.
+type osBackend struct {
+	opts []Option
+}
+
+func (b osBackend) New(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return New(name, perm, b.opts...)
+}
+
+func (b osBackend) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return WriteFile(name, data, perm, b.opts...)
+}
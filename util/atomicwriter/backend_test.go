@@ -0,0 +1,77 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memBackend is the kind of fake a higher layer would inject in tests: it
+// keeps committed files in a map and only publishes them on Close.
+type memBackend struct {
+	files map[string][]byte
+}
+
+type memWriter struct {
+	b    *memBackend
+	name string
+	buf  bytes.Buffer
+}
+
+func (b *memBackend) New(name string, perm os.FileMode) (io.WriteCloser, error) {
+	return &memWriter{b: b, name: name}, nil
+}
+
+func (b *memBackend) WriteFile(name string, data []byte, perm os.FileMode) error {
+	b.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (w *memWriter) Write(dt []byte) (int, error) {
+	return w.buf.Write(dt)
+}
+
+func (w *memWriter) Close() error {
+	w.b.files[w.name] = w.buf.Bytes()
+	return nil
+}
+
+// saveConfig stands in for a higher layer that writes through the Backend
+// interface without knowing which implementation is behind it.
+func saveConfig(b Backend, path string, cfg []byte) error {
+	w, err := b.New(path, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(cfg); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func TestBackend(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.json")
+
+	// the OS backend writes real files, with its options applied to every
+	// write that goes through it
+	osb := NewBackend(WithNoCleanup())
+	require.NoError(t, saveConfig(osb, fn, []byte(`{"a":1}`)))
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":1}`, string(dt))
+	require.NoError(t, osb.WriteFile(fn, []byte(`{"a":2}`), 0o600))
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, `{"a":2}`, string(dt))
+
+	// the same caller works against an in-memory fake
+	mem := &memBackend{files: map[string][]byte{}}
+	require.NoError(t, saveConfig(mem, "/etc/config.json", []byte(`{"a":3}`)))
+	require.Equal(t, `{"a":3}`, string(mem.files["/etc/config.json"]))
+}
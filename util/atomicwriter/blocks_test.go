@@ -0,0 +1,57 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithBlockChecksums(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "blob.bin")
+
+	// 2.5 blocks: the last one is short
+	data := make([]byte, 2560)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	w, err := New(fn, 0o644, WithBlockChecksums(1024, "sha256"))
+	require.NoError(t, err)
+	// split the writes so blocks span Write calls
+	_, err = w.Write(data[:1000])
+	require.NoError(t, err)
+	_, err = w.ReadFrom(bytes.NewReader(data[1000:]))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	manifest, err := os.ReadFile(fn + ".blocks")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(manifest), "\n"), "\n")
+	require.Equal(t, "blocks/v1 sha256 1024", lines[0])
+	require.Len(t, lines, 4)
+	for i, want := range [][]byte{data[:1024], data[1024:2048], data[2048:]} {
+		require.Equal(t, fmt.Sprintf("%x", sha256.Sum256(want)), lines[i+1], "block %d", i)
+	}
+
+	// round trip: rewriting with one block changed flips exactly that line
+	data[1500] ^= 0xff
+	require.NoError(t, WriteFile(fn, data, 0o644, WithBlockChecksums(1024, "sha256")))
+	manifest2, err := os.ReadFile(fn + ".blocks")
+	require.NoError(t, err)
+	lines2 := strings.Split(strings.TrimSuffix(string(manifest2), "\n"), "\n")
+	require.Equal(t, lines[1], lines2[1])
+	require.NotEqual(t, lines[2], lines2[2])
+	require.Equal(t, lines[3], lines2[3])
+
+	_, err = New(fn, 0o644, WithBlockChecksums(0, "sha256"))
+	require.ErrorContains(t, err, "invalid block size")
+	_, err = New(fn, 0o644, WithBlockChecksums(1024, "crc8"))
+	require.ErrorContains(t, err, "unsupported")
+}
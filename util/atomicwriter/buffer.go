@@ -0,0 +1,55 @@
+package atomicwriter
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultCopyBufSize matches io.Copy's internal buffer size.
+const defaultCopyBufSize = 32 << 10
+
+// WithCopyBufferSize sets the buffer size used when the writer copies from
+// a reader (ReadFrom, CopyFile without a reflink, the staging-directory
+// copy at commit). The default 32KB buffer is fine for small files but
+// leaves bandwidth on the table for blob-sized content on fast storage; a
+// 1MB buffer typically amortizes syscall overhead there. Buffers are pooled
+// per size, so repeated copies do not allocate.
+func WithCopyBufferSize(n int) Option {
+	return func(w *Writer) {
+		w.copyBufSize = n
+	}
+}
+
+// copyBufPools holds one buffer pool per configured size. Writers sharing
+// a size share a pool; in practice a process uses one or two sizes.
+var copyBufPools sync.Map // int -> *sync.Pool
+
+// getCopyBuf returns a pooled buffer of the given size and a function
+// returning it to the pool.
+func getCopyBuf(size int) ([]byte, func()) {
+	if size <= 0 {
+		size = defaultCopyBufSize
+	}
+	p, ok := copyBufPools.Load(size)
+	if !ok {
+		p, _ = copyBufPools.LoadOrStore(size, &sync.Pool{
+			New: func() any {
+				buf := make([]byte, size)
+				return &buf
+			},
+		})
+	}
+	pool := p.(*sync.Pool)
+	buf := pool.Get().(*[]byte)
+	return *buf, func() { pool.Put(buf) }
+}
+
+// validateCopyBufSize rejects nonsensical buffer sizes at construction
+// time rather than panicking in make during the first copy.
+func validateCopyBufSize(n int) error {
+	if n < 0 {
+		return errors.Errorf("invalid copy buffer size %d", n)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithCopyBufferSize(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 256<<10)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+
+	dest := filepath.Join(dir, "blob")
+	w, err := New(dest, 0o644, WithCopyBufferSize(1<<20))
+	require.NoError(t, err)
+	_, err = w.ReadFrom(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, data, dt)
+
+	// the buffer size also applies to the commit-time copy out of a
+	// staging directory
+	dest2 := filepath.Join(dir, "staged")
+	require.NoError(t, WriteFile(dest2, data, 0o644, WithCopyBufferSize(1<<20), WithTmpfsStaging(dir)))
+	dt, err = os.ReadFile(dest2)
+	require.NoError(t, err)
+	require.Equal(t, data, dt)
+
+	_, err = New(filepath.Join(dir, "bad"), 0o644, WithCopyBufferSize(-1))
+	require.ErrorContains(t, err, "invalid copy buffer size")
+}
+
+func BenchmarkCopyBufferSize(b *testing.B) {
+	data := make([]byte, 64<<20)
+	if _, err := rand.Read(data); err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name string
+		size int
+	}{
+		{"32KB", 32 << 10},
+		{"1MB", 1 << 20},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			dir := b.TempDir()
+			dest := filepath.Join(dir, "blob")
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w, err := New(dest, 0o644, WithCopyBufferSize(bc.size))
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := w.ReadFrom(bytes.NewReader(data)); err != nil {
+					b.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
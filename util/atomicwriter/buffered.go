@@ -0,0 +1,59 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// BufferedWriter accumulates all written content in memory and performs a
+// single atomic commit on Close, so no temporary file exists during the
+// write window at all. For small frequently-rewritten files this avoids the
+// temp-file churn of New, and a writer that is Discarded before Close never
+// touches the filesystem. The whole content is held in memory, so this is
+// meant for small files, not blobs. Unlike LazyWriter it always commits,
+// even when the content is unchanged.
+type BufferedWriter struct {
+	fn     string
+	perm   os.FileMode
+	opts   []Option
+	buf    bytes.Buffer
+	closed bool
+}
+
+// NewBuffered returns a BufferedWriter for filename. The destination is
+// validated up front; the temporary file is only created by Close.
+func NewBuffered(filename string, perm os.FileMode, opts ...Option) (*BufferedWriter, error) {
+	if _, err := validateDestination(filename); err != nil {
+		return nil, err
+	}
+	return &BufferedWriter{
+		fn:   filename,
+		perm: perm,
+		opts: opts,
+	}, nil
+}
+
+func (bw *BufferedWriter) Write(dt []byte) (int, error) {
+	if bw.closed {
+		return 0, errors.New("buffered writer is already closed")
+	}
+	return bw.buf.Write(dt)
+}
+
+// Close materializes the buffered content as a single atomic write to the
+// destination.
+func (bw *BufferedWriter) Close() error {
+	if bw.closed {
+		return nil
+	}
+	bw.closed = true
+	return WriteFile(bw.fn, bw.buf.Bytes(), bw.perm, bw.opts...)
+}
+
+// Discard drops the buffered content; the filesystem was never touched.
+func (bw *BufferedWriter) Discard() {
+	bw.closed = true
+	bw.buf.Reset()
+}
@@ -0,0 +1,48 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferedWriter(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "small.conf")
+
+	bw, err := NewBuffered(fn, 0o644)
+	require.NoError(t, err)
+	_, err = bw.Write([]byte("key="))
+	require.NoError(t, err)
+
+	// nothing on disk until Close
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	_, err = bw.Write([]byte("value"))
+	require.NoError(t, err)
+	require.NoError(t, bw.Close())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "key=value", string(dt))
+
+	_, err = bw.Write([]byte("late"))
+	require.ErrorContains(t, err, "already closed")
+
+	// a discarded writer never touches the filesystem
+	bw, err = NewBuffered(filepath.Join(dir, "dropped.conf"), 0o644)
+	require.NoError(t, err)
+	_, err = bw.Write([]byte("x"))
+	require.NoError(t, err)
+	bw.Discard()
+	require.NoError(t, bw.Close())
+	_, err = os.Stat(filepath.Join(dir, "dropped.conf"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = NewBuffered(dir, 0o644)
+	require.ErrorIs(t, err, ErrIsDirectory)
+}
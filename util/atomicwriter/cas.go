@@ -0,0 +1,58 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCASConflict is returned by WriteFileCAS when the destination's current
+// content does not hash to the expected value.
+var ErrCASConflict = errors.New("destination content changed")
+
+// WriteFileCAS atomically replaces filename only if its current content
+// hashes to expectedSHA256 (compare-and-swap for optimistic concurrency
+// between multiple writers). A nil expectedSHA256 requires the destination
+// to not exist yet. On mismatch it aborts with ErrCASConflict and removes
+// the temp file.
+//
+// The check is best-effort: there is an inherent TOCTOU window between
+// hashing the current content and the commit rename, so a concurrent
+// writer racing within that window can still be lost.
+func WriteFileCAS(filename string, data []byte, perm os.FileMode, expectedSHA256 []byte) error {
+	return WriteFile(filename, data, perm, WithPreCommit(func(string) error {
+		current, err := hashFile(filename)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if expectedSHA256 != nil {
+				return errors.Wrap(ErrCASConflict, "destination no longer exists")
+			}
+			return nil
+		case err != nil:
+			return err
+		case expectedSHA256 == nil:
+			return errors.Wrap(ErrCASConflict, "destination already exists")
+		case !bytes.Equal(current, expectedSHA256):
+			return ErrCASConflict
+		}
+		return nil
+	}))
+}
+
+// hashFile returns the SHA256 of the file's content.
+func hashFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
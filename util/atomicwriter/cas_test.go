@@ -0,0 +1,37 @@
+package atomicwriter
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileCAS(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.json")
+
+	// nil expected hash means "must not exist yet"
+	require.NoError(t, WriteFileCAS(fn, []byte("v1"), 0o644, nil))
+	err := WriteFileCAS(fn, []byte("v2"), 0o644, nil)
+	require.ErrorIs(t, err, ErrCASConflict)
+
+	// update succeeds with the hash of the content we last read
+	h := sha256.Sum256([]byte("v1"))
+	require.NoError(t, WriteFileCAS(fn, []byte("v2"), 0o644, h[:]))
+
+	// a stale hash fails and leaves the destination untouched
+	err = WriteFileCAS(fn, []byte("v3"), 0o644, h[:])
+	require.ErrorIs(t, err, ErrCASConflict)
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(dt))
+
+	// no leftover temp files
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
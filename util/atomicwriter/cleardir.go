@@ -0,0 +1,43 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ClearDir atomically empties a directory: readers observe either the full
+// old contents or an empty directory, never a partially-cleared state. The
+// directory is renamed aside to a temporary sibling, an empty directory with
+// the old one's mode (and, where supported, owner) is created in its place,
+// and the old contents are removed in the background. Removal is
+// best-effort; a crash can leave a .tmp-clear-* sibling behind for a later
+// sweep, but the visible directory is already empty by then.
+func ClearDir(target string) error {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("cannot clear %s: not a directory", target)
+	}
+	aside := filepath.Join(filepath.Dir(abs), fmt.Sprintf(".tmp-clear-%s-%d-%d", filepath.Base(abs), os.Getpid(), rootTempSeq.Add(1)))
+	if err := os.Rename(abs, aside); err != nil {
+		return err
+	}
+	if err := os.Mkdir(abs, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if uid, gid, ok := fileOwner(fi); ok {
+		// best-effort: only root can restore another user's ownership
+		os.Chown(abs, uid, gid)
+	}
+	go os.RemoveAll(aside)
+	return nil
+}
@@ -0,0 +1,47 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClearDir(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "assets")
+	require.NoError(t, os.Mkdir(target, 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(target, "a.txt"), []byte("a"), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(target, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(target, "sub", "b.txt"), []byte("b"), 0o644))
+
+	require.NoError(t, ClearDir(target))
+
+	entries, err := os.ReadDir(target)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(target)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o750), fi.Mode().Perm())
+	}
+
+	// the background removal eventually cleans up the renamed-aside tree
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		return len(entries) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = ClearDir(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	fn := filepath.Join(dir, "file.txt")
+	require.NoError(t, os.WriteFile(fn, []byte("x"), 0o644))
+	err = ClearDir(fn)
+	require.ErrorContains(t, err, "not a directory")
+}
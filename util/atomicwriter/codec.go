@@ -0,0 +1,52 @@
+package atomicwriter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Codec serializes a value onto a stream. Implementations wrap an encoder
+// from any serialization package — encoding/gob, YAML and protobuf
+// libraries all offer a stream encoder that adapts in a few lines:
+//
+//	type gobCodec struct{}
+//
+//	func (gobCodec) Encode(w io.Writer, v any) error {
+//		return gob.NewEncoder(w).Encode(v)
+//	}
+type Codec interface {
+	Encode(w io.Writer, v any) error
+}
+
+// JSONCodec encodes values as JSON with a trailing newline, matching
+// json.Encoder's framing.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// WriteEncoded atomically writes v to filename serialized with codec,
+// replacing marshal-then-WriteFile boilerplate. The encoder streams
+// straight into the temporary file, so nothing is buffered in memory
+// beyond the encoder's own needs, and the destination is only replaced
+// when the encode completes: an encode error discards the partial output
+// and leaves any existing file untouched. Options compose as with
+// WriteFile — the encoded stream passes through tees, checksum sidecars
+// and size limits like any other written content.
+func WriteEncoded(filename string, perm os.FileMode, v any, codec Codec, opts ...Option) error {
+	w, err := New(filename, perm, opts...)
+	if err != nil {
+		return err
+	}
+	if err := codec.Encode(w, v); err != nil {
+		w.Discard()
+		return errors.Wrap(err, "encoding content")
+	}
+	return w.Close()
+}
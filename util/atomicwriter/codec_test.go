@@ -0,0 +1,68 @@
+package atomicwriter
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type codecConfig struct {
+	Name    string   `json:"name"`
+	Replica int      `json:"replica"`
+	Tags    []string `json:"tags"`
+}
+
+// failingCodec writes a partial prefix before erroring, to prove partial
+// encoder output never reaches the destination.
+type failingCodec struct{}
+
+func (failingCodec) Encode(w io.Writer, v any) error {
+	if _, err := w.Write([]byte("partial")); err != nil {
+		return err
+	}
+	return errors.New("encode failed")
+}
+
+func TestWriteEncoded(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "config.json")
+
+	in := codecConfig{Name: "build", Replica: 3, Tags: []string{"a", "b"}}
+	require.NoError(t, WriteEncoded(fn, 0o644, in, JSONCodec))
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, byte('\n'), dt[len(dt)-1], "json.Encoder framing includes a trailing newline")
+	var out codecConfig
+	require.NoError(t, json.Unmarshal(dt, &out))
+	require.Equal(t, in, out)
+
+	// options compose: the encoded stream feeds the checksum sidecar
+	require.NoError(t, WriteEncoded(fn, 0o644, in, JSONCodec, WithChecksumSidecar("sha256")))
+	_, err = os.Stat(fn + ".sha256")
+	require.NoError(t, err)
+
+	// an encode error aborts the write and keeps the existing content
+	err = WriteEncoded(fn, 0o644, in, failingCodec{})
+	require.ErrorContains(t, err, "encode failed")
+	dt2, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, dt, dt2)
+
+	// unencodable values abort too, without creating the destination
+	missing := filepath.Join(dir, "missing.json")
+	err = WriteEncoded(missing, 0o644, make(chan int), JSONCodec)
+	require.Error(t, err)
+	_, err = os.Stat(missing)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// no temp files survive the aborted writes
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
@@ -0,0 +1,71 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "log.gz")
+	content := bytes.Repeat([]byte("a compressible line of text\n"), 1024)
+
+	require.NoError(t, WriteFile(fn, content, 0o644, WithGzip()))
+
+	// the file on disk is gzip, and smaller than the content
+	raw, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Greater(t, len(raw), 2)
+	require.Equal(t, gzipMagic[:], raw[:2])
+	require.Less(t, len(raw), len(content))
+
+	r, err := OpenCompressed(fn)
+	require.NoError(t, err)
+	dt, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, content, dt)
+}
+
+func TestOpenCompressedPlainFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// plain files pass through untouched, including ones shorter than the
+	// gzip magic
+	for name, content := range map[string][]byte{
+		"plain.txt": []byte("not compressed"),
+		"short.txt": []byte("x"),
+		"empty.txt": nil,
+	} {
+		fn := filepath.Join(dir, name)
+		require.NoError(t, WriteFile(fn, content, 0o644))
+		r, err := OpenCompressed(fn)
+		require.NoError(t, err)
+		dt, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.Equal(t, string(content), string(dt), name)
+	}
+
+	_, err := OpenCompressed(filepath.Join(dir, "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestGzipWriterNoWrites(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "empty.gz")
+
+	// a writer that never saw a Write commits an empty file, not an empty
+	// gzip stream
+	w, err := New(fn, 0o644, WithGzip())
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Zero(t, fi.Size())
+}
@@ -0,0 +1,44 @@
+package atomicwriter
+
+import (
+	"io"
+	"os"
+)
+
+// PermPreserve is a sentinel for CopyFile's perm argument meaning "use the
+// source file's permission bits".
+const PermPreserve = ^os.FileMode(0)
+
+// CopyFile atomically makes dst identical to src: the content is staged in
+// a temporary file in dst's directory and renamed into place, so readers of
+// dst never observe a partial copy. When src and the destination directory
+// share a filesystem with reflink support, the copy shares data blocks
+// instead of duplicating them. perm sets the destination's permission bits;
+// pass PermPreserve to carry over src's mode.
+func CopyFile(dst, src string, perm os.FileMode, opts ...Option) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	fi, err := sf.Stat()
+	if err != nil {
+		return err
+	}
+	if perm == PermPreserve {
+		perm = fi.Mode().Perm()
+	}
+	w, err := New(dst, perm, opts...)
+	if err != nil {
+		return err
+	}
+	// the reflink fast path bypasses Write, so it is only taken when no
+	// option needs to observe the byte stream
+	if len(w.tees) == 0 && w.maxBytes == 0 && !w.gzipOn && cloneFile(w.f, sf) {
+		w.written = fi.Size()
+	} else if _, err := io.Copy(w, sf); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,52 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dst := filepath.Join(dir, "dst.txt")
+	require.NoError(t, os.WriteFile(src, []byte("copied content"), 0o640))
+
+	require.NoError(t, CopyFile(dst, src, 0o644))
+	dt, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "copied content", string(dt))
+	fi, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	// PermPreserve carries over the source's mode
+	dst2 := filepath.Join(dir, "dst2.txt")
+	require.NoError(t, CopyFile(dst2, src, PermPreserve))
+	fi, err = os.Stat(dst2)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+
+	// replacing an existing destination is atomic and leaves no leftovers
+	require.NoError(t, os.WriteFile(src, []byte("updated"), 0o640))
+	require.NoError(t, CopyFile(dst, src, 0o644))
+	dt, err = os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "updated", string(dt))
+
+	err = CopyFile(dst, filepath.Join(dir, "missing"), 0o644)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCopyFileWithMaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.bin")
+	require.NoError(t, os.WriteFile(src, make([]byte, 1024), 0o644))
+
+	err := CopyFile(filepath.Join(dir, "dst.bin"), src, 0o644, WithMaxBytes(512))
+	require.ErrorIs(t, err, ErrSizeLimitExceeded)
+	_, err = os.Stat(filepath.Join(dir, "dst.bin"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
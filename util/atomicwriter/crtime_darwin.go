@@ -0,0 +1,23 @@
+package atomicwriter
+
+import (
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setCreationTime sets the file's creation time (crtime) via setattrlist.
+func setCreationTime(path string, t time.Time) error {
+	attrList := unix.Attrlist{
+		Bitmapcount: unix.ATTR_BIT_MAP_COUNT,
+		Commonattr:  unix.ATTR_CMN_CRTIME,
+	}
+	ts := unix.NsecToTimespec(t.UnixNano())
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+	if err := unix.Setattrlist(path, &attrList, buf, 0); err != nil {
+		return errors.Wrapf(err, "failed to set creation time on %s", path)
+	}
+	return nil
+}
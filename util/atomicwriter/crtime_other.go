@@ -0,0 +1,11 @@
+//go:build !darwin && !windows
+
+package atomicwriter
+
+import "time"
+
+// setCreationTime is a no-op: Linux and the BSDs do not expose a public API
+// to set a file's creation time.
+func setCreationTime(path string, t time.Time) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+package atomicwriter
+
+import (
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// setCreationTime sets the file's creation time via SetFileTime.
+func setCreationTime(path string, t time.Time) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctime := windows.NsecToFiletime(t.UnixNano())
+	if err := windows.SetFileTime(windows.Handle(f.Fd()), &ctime, nil, nil); err != nil {
+		return errors.Wrapf(err, "failed to set creation time on %s", path)
+	}
+	return nil
+}
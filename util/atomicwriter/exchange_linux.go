@@ -0,0 +1,16 @@
+package atomicwriter
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameExchange atomically swaps the two paths; both must exist and live
+// on the same filesystem.
+func renameExchange(a, b string) error {
+	if err := unix.Renameat2(unix.AT_FDCWD, a, unix.AT_FDCWD, b, unix.RENAME_EXCHANGE); err != nil {
+		return &os.LinkError{Op: "rename", Old: a, New: b, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package atomicwriter
+
+import "github.com/pkg/errors"
+
+// renameExchange requires RENAME_EXCHANGE, which only Linux offers; other
+// platforms have no atomic two-way swap to build CommitMerge on.
+func renameExchange(a, b string) error {
+	return errors.New("atomic directory exchange is only supported on linux")
+}
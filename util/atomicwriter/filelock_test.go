@@ -0,0 +1,67 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithFileLock(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "counter")
+	require.NoError(t, os.WriteFile(dest, []byte("0"), 0o644))
+
+	// each subprocess does a read-modify-write increment under the lock;
+	// without cross-process serialization some increments would be lost
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run", "TestFileLockChild", "-test.v")
+			cmd.Env = append(os.Environ(), "ATOMICWRITER_LOCK_CHILD=1", "ATOMICWRITER_LOCK_DEST="+dest)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				errs <- errors.Wrapf(err, "child failed: %s", out)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	dt, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	require.Equal(t, strconv.Itoa(workers), string(dt))
+	// the lock file stays behind; removing it would race the next locker
+	require.FileExists(t, dest+".lock")
+}
+
+// TestFileLockChild is the subprocess body for TestWithFileLock; it only
+// runs when re-executed with the environment set up by the parent.
+func TestFileLockChild(t *testing.T) {
+	if os.Getenv("ATOMICWRITER_LOCK_CHILD") != "1" {
+		t.Skip("helper for TestWithFileLock")
+	}
+	dest := os.Getenv("ATOMICWRITER_LOCK_DEST")
+	w, err := New(dest, 0o644, WithFileLock())
+	require.NoError(t, err)
+	dt, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	n, err := strconv.Atoi(strings.TrimSpace(string(dt)))
+	require.NoError(t, err)
+	_, err = fmt.Fprintf(w, "%d", n+1)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,62 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCRCFooterRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "data.bin")
+	content := bytes.Repeat([]byte("payload"), 100)
+
+	require.NoError(t, WriteFile(fn, content, 0o644, WithCRCFooter()))
+
+	// the footer is appended after the content
+	raw, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Len(t, raw, len(content)+crcFooterSize)
+	require.Equal(t, crcFooterMagic[:], raw[len(raw)-4:])
+
+	dt, err := OpenVerified(fn)
+	require.NoError(t, err)
+	require.Equal(t, content, dt)
+
+	// empty content verifies too
+	require.NoError(t, WriteFile(fn, nil, 0o644, WithCRCFooter()))
+	dt, err = OpenVerified(fn)
+	require.NoError(t, err)
+	require.Empty(t, dt)
+}
+
+func TestCRCFooterCorruption(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "data.bin")
+	require.NoError(t, WriteFile(fn, []byte("sensor readings"), 0o644, WithCRCFooter()))
+
+	// flip a content byte: the checksum no longer matches
+	raw, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	flipped := append([]byte{}, raw...)
+	flipped[0] ^= 0x01
+	require.NoError(t, os.WriteFile(fn, flipped, 0o644))
+	_, err = OpenVerified(fn)
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// truncate mid-content: the recorded length no longer matches
+	truncated := append(append([]byte{}, raw[:4]...), raw[len(raw)-crcFooterSize:]...)
+	require.NoError(t, os.WriteFile(fn, truncated, 0o644))
+	_, err = OpenVerified(fn)
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// a file without a footer is reported as such, not as corrupt
+	require.NoError(t, os.WriteFile(fn, []byte("plain"), 0o644))
+	_, err = OpenVerified(fn)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrCorrupt)
+	require.ErrorContains(t, err, "no CRC footer")
+}
@@ -0,0 +1,31 @@
+package atomicwriter
+
+import "golang.org/x/sys/unix"
+
+// statfs f_type magics for filesystems with non-local semantics;
+// V9FS_MAGIC, FUSE_SUPER_MAGIC and OVERLAYFS_SUPER_MAGIC from
+// linux/magic.h.
+const (
+	v9fsSuperMagic    = 0x01021997
+	fuseSuperMagic    = 0x65735546
+	overlaySuperMagic = 0x794c7630
+)
+
+// detectFSType classifies the filesystem holding dir by its statfs magic.
+// Detection failures report FSTypeUnknown — the writer then behaves as on
+// a local filesystem.
+func detectFSType(dir string) FSType {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return FSTypeUnknown
+	}
+	switch st.Type {
+	case v9fsSuperMagic:
+		return FSType9P
+	case fuseSuperMagic:
+		return FSTypeVirtiofs
+	case overlaySuperMagic:
+		return FSTypeOverlay
+	}
+	return FSTypeUnknown
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package atomicwriter
+
+// detectFSType has no statfs magic to inspect outside Linux; everything is
+// treated as an ordinary local filesystem.
+func detectFSType(dir string) FSType {
+	return FSTypeUnknown
+}
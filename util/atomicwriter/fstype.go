@@ -0,0 +1,45 @@
+package atomicwriter
+
+// FSType classifies the filesystem a writer stages and commits on, for the
+// handful of transports whose rename and fsync semantics differ from a
+// local POSIX filesystem.
+type FSType string
+
+const (
+	// FSTypeUnknown means detection was unavailable or the filesystem is
+	// an ordinary local one.
+	FSTypeUnknown FSType = ""
+	// FSType9P is a Plan 9 filesystem transport, common for VM shared
+	// directories.
+	FSType9P FSType = "9p"
+	// FSTypeVirtiofs is a FUSE-based transport (virtiofs presents itself
+	// as FUSE; other FUSE filesystems match too, which err on the careful
+	// side).
+	FSTypeVirtiofs FSType = "virtiofs"
+	// FSTypeOverlay is an overlayfs union mount, where rewriting a file
+	// that lives in a lower layer first copies it up to the upper layer.
+	FSTypeOverlay FSType = "overlay"
+)
+
+// fsTypeOf is a seam over the platform statfs detection, overridden in
+// tests to simulate transports the test host does not have.
+var fsTypeOf = detectFSType
+
+// Filesystem reports the detected class of the filesystem holding the
+// destination. On 9p and virtiofs the writer's guarantees weaken with the
+// transport: rename over an existing name is not always atomic on the
+// host side, and an acknowledged fsync may not have reached stable
+// storage. The writer compensates where it can — the explicit data fsync
+// is never skipped there, even under WithODSync — but atomicity remains
+// best-effort, and callers with stronger needs can use this to decide on
+// a different strategy.
+func (w *Writer) Filesystem() FSType {
+	return w.fsType
+}
+
+// weakSyncSemantics reports whether the transport may silently weaken
+// open-flag based sync guarantees, so the writer should keep its explicit
+// commit-time fsync.
+func (t FSType) weakSyncSemantics() bool {
+	return t == FSType9P || t == FSTypeVirtiofs
+}
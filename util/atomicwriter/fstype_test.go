@@ -0,0 +1,45 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemDetection(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "test.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	require.Equal(t, FSTypeUnknown, w.Filesystem())
+	require.NoError(t, w.Discard())
+
+	// simulate a 9p mount through the detection seam
+	restore := fsTypeOf
+	fsTypeOf = func(dir string) FSType { return FSType9P }
+	defer func() { fsTypeOf = restore }()
+
+	w, err = New(fn, 0o644)
+	require.NoError(t, err)
+	require.Equal(t, FSType9P, w.Filesystem())
+
+	// on a weak transport the explicit data fsync must happen even when
+	// the temp file was opened for synchronous writes
+	w.odsync = true
+	syncs := 0
+	w.fsync = func(f *os.File) error {
+		syncs++
+		return f.Sync()
+	}
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NotZero(t, syncs, "commit skipped the explicit fsync on a 9p transport")
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(dt))
+}
@@ -0,0 +1,65 @@
+package atomicwriter
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// FuzzValidateDestination feeds arbitrary strings into destination
+// validation. The invariants are that it never panics and that the empty
+// name is always rejected; everything else is allowed to either pass or
+// fail depending on what happens to exist on disk.
+func FuzzValidateDestination(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"foo.txt",
+		"/dev/null",
+		"..",
+		"../escape.txt",
+		"dir/",
+		"a\x00b",
+		strings.Repeat("x", 4096),
+		"foo/../bar",
+		".",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		_, err := validateDestination(name)
+		if name == "" && err == nil {
+			t.Fatal("empty destination was not rejected")
+		}
+	})
+}
+
+// FuzzWriteSetName feeds arbitrary file names into the staging-root
+// traversal check. If a name is accepted, its resolved parent directory must
+// still be inside the root.
+func FuzzWriteSetName(f *testing.F) {
+	for _, seed := range []string{
+		"a.txt",
+		"sub/a.txt",
+		"../escape.txt",
+		"sub/../../escape.txt",
+		"..",
+		".",
+		"/abs/path.txt",
+		"sub//double/sep.txt",
+		"trailing/sep/",
+		"a\x00b",
+	} {
+		f.Add(seed)
+	}
+	root := filepath.Join(string(filepath.Separator), "staging", "write-set-fuzz")
+	f.Fuzz(func(t *testing.T, name string) {
+		rel, err := relStagingDir(root, name)
+		if err != nil {
+			return
+		}
+		dir := filepath.Join(root, rel)
+		if dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			t.Fatalf("accepted name %q resolves outside the root: %s", name, dir)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// PendingCommit is one staged temporary file and the destination it is to
+// be renamed over, for committing related files as a group.
+type PendingCommit struct {
+	// TempPath is the fully-written temporary file, on the same filesystem
+	// as Dest.
+	TempPath string
+	// Dest is the destination the temporary file is renamed over.
+	Dest string
+}
+
+// CommitGroup commits a set of related files — say, a data file and its
+// index — with the smallest possible window between them becoming visible.
+// All destinations are validated and all temporary files fsynced up front,
+// then the renames are issued back-to-back with nothing but the rename
+// syscalls in between, and finally the affected parent directories are
+// fsynced so the renames survive a crash.
+//
+// True cross-file atomicity is not possible without filesystem journaling:
+// a crash between two renames can still surface one file without the
+// other. Grouping the renames after all preparatory I/O shrinks that gap
+// to the width of the syscalls themselves. A rename failure partway
+// through returns a *CommitError recording which destinations already
+// committed; the remaining temporary files are left in place.
+func CommitGroup(commits []PendingCommit) error {
+	for _, c := range commits {
+		if _, err := validateDestination(c.Dest); err != nil {
+			return err
+		}
+	}
+	for _, c := range commits {
+		f, err := os.Open(c.TempPath)
+		if err != nil {
+			return err
+		}
+		err = f.Sync()
+		if err1 := f.Close(); err == nil {
+			err = err1
+		}
+		if err != nil {
+			return err
+		}
+	}
+	var committed []string
+	dirs := map[string]struct{}{}
+	for _, c := range commits {
+		if err := osRename(c.TempPath, c.Dest); err != nil {
+			return &CommitError{Committed: committed, Err: err}
+		}
+		committed = append(committed, c.Dest)
+		dirs[filepath.Dir(c.Dest)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return &CommitError{Committed: committed, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitGroup(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "table.data")
+	index := filepath.Join(dir, "table.index")
+	require.NoError(t, os.WriteFile(data, []byte("old data"), 0o644))
+
+	tmpData := filepath.Join(dir, ".tmp-data")
+	tmpIndex := filepath.Join(dir, ".tmp-index")
+	require.NoError(t, os.WriteFile(tmpData, []byte("new data"), 0o644))
+	require.NoError(t, os.WriteFile(tmpIndex, []byte("new index"), 0o644))
+
+	require.NoError(t, CommitGroup([]PendingCommit{
+		{TempPath: tmpData, Dest: data},
+		{TempPath: tmpIndex, Dest: index},
+	}))
+
+	dt, err := os.ReadFile(data)
+	require.NoError(t, err)
+	require.Equal(t, "new data", string(dt))
+	dt, err = os.ReadFile(index)
+	require.NoError(t, err)
+	require.Equal(t, "new index", string(dt))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestCommitGroupPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	tmp := filepath.Join(dir, ".tmp-data")
+	require.NoError(t, os.WriteFile(tmp, []byte("data"), 0o644))
+
+	// the second rename fails (a directory cannot replace a regular file):
+	// the error reports what already committed and leaves the rest alone
+	tmpDir := filepath.Join(dir, ".tmp-dir")
+	require.NoError(t, os.Mkdir(tmpDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b"), []byte("old"), 0o644))
+	err := CommitGroup([]PendingCommit{
+		{TempPath: tmp, Dest: filepath.Join(dir, "a")},
+		{TempPath: tmpDir, Dest: filepath.Join(dir, "b")},
+	})
+	var cerr *CommitError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, []string{filepath.Join(dir, "a")}, cerr.Committed)
+	_, err = os.Stat(filepath.Join(dir, "a"))
+	require.NoError(t, err)
+	dt, err := os.ReadFile(filepath.Join(dir, "b"))
+	require.NoError(t, err)
+	require.Equal(t, "old", string(dt))
+
+	// invalid destinations are rejected before anything is touched
+	require.NoError(t, os.WriteFile(tmp, []byte("data"), 0o644))
+	err = CommitGroup([]PendingCommit{
+		{TempPath: tmp, Dest: dir},
+	})
+	require.Error(t, err)
+	_, err = os.Stat(tmp)
+	require.NoError(t, err)
+}
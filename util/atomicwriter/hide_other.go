@@ -0,0 +1,10 @@
+//go:build !windows
+
+package atomicwriter
+
+// hideTempFile and unhideTempFile are no-ops outside Windows: dot-prefixed
+// temp names are already hidden by convention and carry no attribute that
+// would survive the commit rename.
+func hideTempFile(name string) {}
+
+func unhideTempFile(name string) {}
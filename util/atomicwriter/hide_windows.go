@@ -0,0 +1,25 @@
+package atomicwriter
+
+import "golang.org/x/sys/windows"
+
+// hideTempFile marks the temporary file hidden so it does not flicker into
+// view in Explorer during the write window, and temporary so the cache
+// manager can defer writing it out. Best-effort: failures are ignored.
+func hideTempFile(name string) {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return
+	}
+	windows.SetFileAttributes(p, windows.FILE_ATTRIBUTE_HIDDEN|windows.FILE_ATTRIBUTE_TEMPORARY)
+}
+
+// unhideTempFile clears the attributes set by hideTempFile. File attributes
+// survive a rename, so without this the committed destination would stay
+// hidden.
+func unhideTempFile(name string) {
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return
+	}
+	windows.SetFileAttributes(p, windows.FILE_ATTRIBUTE_NORMAL)
+}
@@ -0,0 +1,66 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// LazyWriter buffers all written content in memory and only touches the
+// filesystem on Close: if the accumulated content equals the destination's
+// current content, nothing is written at all (preserving mtime and avoiding
+// spurious inotify events); otherwise the content is committed atomically
+// like WriteFile. The whole content is held in memory, so this is meant for
+// reasonably small generated files such as configs, not blobs.
+type LazyWriter struct {
+	fn        string
+	perm      os.FileMode
+	opts      []Option
+	buf       bytes.Buffer
+	closed    bool
+	unchanged bool
+}
+
+// NewLazy returns a LazyWriter for filename. The destination is validated
+// up front; no temporary file is created unless Close decides the content
+// changed.
+func NewLazy(filename string, perm os.FileMode, opts ...Option) (*LazyWriter, error) {
+	if _, err := validateDestination(filename); err != nil {
+		return nil, err
+	}
+	return &LazyWriter{
+		fn:   filename,
+		perm: perm,
+		opts: opts,
+	}, nil
+}
+
+func (lw *LazyWriter) Write(dt []byte) (int, error) {
+	if lw.closed {
+		return 0, errors.New("lazy writer is already closed")
+	}
+	return lw.buf.Write(dt)
+}
+
+// Unchanged reports whether Close was a no-op because the content matched
+// the existing destination.
+func (lw *LazyWriter) Unchanged() bool {
+	return lw.closed && lw.unchanged
+}
+
+// Close commits the buffered content atomically, unless it is identical to
+// the destination's current content, in which case the destination is left
+// completely untouched.
+func (lw *LazyWriter) Close() error {
+	if lw.closed {
+		return nil
+	}
+	lw.closed = true
+	existing, err := os.ReadFile(lw.fn)
+	if err == nil && bytes.Equal(existing, lw.buf.Bytes()) {
+		lw.unchanged = true
+		return nil
+	}
+	return WriteFile(lw.fn, lw.buf.Bytes(), lw.perm, lw.opts...)
+}
@@ -0,0 +1,51 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyWriter(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "app.conf")
+
+	lw, err := NewLazy(fn, 0o644)
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("generated"))
+	require.NoError(t, err)
+	require.NoError(t, lw.Close())
+	require.False(t, lw.Unchanged())
+
+	fi1, err := os.Stat(fn)
+	require.NoError(t, err)
+
+	// identical regeneration leaves the file completely untouched
+	lw, err = NewLazy(fn, 0o644)
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("generated"))
+	require.NoError(t, err)
+	require.NoError(t, lw.Close())
+	require.True(t, lw.Unchanged())
+
+	fi2, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, fi1.ModTime(), fi2.ModTime())
+
+	// changed content is committed
+	lw, err = NewLazy(fn, 0o644)
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("regenerated"))
+	require.NoError(t, err)
+	require.NoError(t, lw.Close())
+	require.False(t, lw.Unchanged())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "regenerated", string(dt))
+
+	_, err = lw.Write([]byte("late"))
+	require.ErrorContains(t, err, "already closed")
+}
@@ -0,0 +1,103 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WithUpdateAllLinks changes what happens when the destination exists with
+// more than one hardlink: instead of renaming over one name (which breaks
+// the link set — the other names keep the old inode), the staged content is
+// written into the existing inode in place, so every hardlinked name
+// observes the update. This trades away crash-atomicity for that one case:
+// a crash mid-rewrite leaves the inode truncated or partially written,
+// visible under all its names. An advisory lock on the inode keeps
+// concurrent in-place updaters from interleaving, but readers can observe
+// the intermediate states. When the destination is missing or has a single
+// link, the commit is the usual atomic rename.
+func WithUpdateAllLinks() Option {
+	return func(w *Writer) {
+		w.updateAllLinks = true
+	}
+}
+
+// rewriteInPlace copies the staged file src into the destination's
+// existing inode, consuming src on success.
+func (w *Writer) rewriteInPlace(src string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(w.fn, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+	if err := flockExclusive(df); err == nil {
+		defer flockUnlock(df)
+	}
+	if err := df.Truncate(0); err != nil {
+		return err
+	}
+	buf, release := getCopyBuf(w.copyBufSize)
+	_, err = io.CopyBuffer(df, sf, buf)
+	release()
+	if err != nil {
+		return err
+	}
+	if !w.createMode {
+		if err := df.Chmod(w.perm); err != nil && !isPermUnsupportedErr(err) {
+			return err
+		}
+	}
+	if err := w.doSync(df); err != nil {
+		return err
+	}
+	if err := df.Close(); err != nil {
+		return err
+	}
+	if !w.noCleanup {
+		os.Remove(src)
+	}
+	return nil
+}
+
+// WriteFileLinks atomically writes data to primary and hardlinks it under
+// each name in extraNames, so the same bytes appear under several names
+// without writing them more than once (multi-named content-addressed cache
+// entries). Each extra name is committed by linking to a temporary name and
+// renaming it into place, so replacing an existing name is atomic too. If
+// any link fails, the links created so far are removed; the primary is left
+// in place, as it was already committed.
+func WriteFileLinks(primary string, extraNames []string, data []byte, perm os.FileMode, opts ...Option) error {
+	for _, name := range extraNames {
+		if _, err := validateDestination(name); err != nil {
+			return err
+		}
+	}
+	if err := WriteFile(primary, data, perm, opts...); err != nil {
+		return err
+	}
+	var created []string
+	for _, name := range extraNames {
+		tmp := filepath.Join(filepath.Dir(name), fmt.Sprintf(".tmp-%s-%d", filepath.Base(name), os.Getpid()))
+		err := os.Link(primary, tmp)
+		if err == nil {
+			err = os.Rename(tmp, name)
+			if err != nil {
+				os.Remove(tmp)
+			}
+		}
+		if err != nil {
+			for _, c := range created {
+				os.Remove(c)
+			}
+			return err
+		}
+		created = append(created, name)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileLinks(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "blob")
+	extras := []string{filepath.Join(dir, "by-tag"), filepath.Join(dir, "latest")}
+
+	// one of the extra names already exists and gets replaced atomically
+	require.NoError(t, os.WriteFile(extras[1], []byte("old"), 0o644))
+
+	require.NoError(t, WriteFileLinks(primary, extras, []byte("content"), 0o644))
+
+	pfi, err := os.Stat(primary)
+	require.NoError(t, err)
+	for _, name := range extras {
+		dt, err := os.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, "content", string(dt))
+		fi, err := os.Stat(name)
+		require.NoError(t, err)
+		require.True(t, os.SameFile(pfi, fi), name)
+	}
+
+	// a directory extra name is rejected before anything is written
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "dir"), 0o755))
+	err = WriteFileLinks(filepath.Join(dir, "other"), []string{filepath.Join(dir, "dir")}, []byte("x"), 0o644)
+	require.ErrorIs(t, err, ErrIsDirectory)
+	_, err = os.Stat(filepath.Join(dir, "other"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriteFileLinksRollback(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "blob")
+	good := filepath.Join(dir, "good")
+	bad := filepath.Join(dir, "missing-parent", "bad")
+
+	err := WriteFileLinks(primary, []string{good, bad}, []byte("content"), 0o644)
+	require.Error(t, err)
+
+	// the primary stays committed, the partial extra link is rolled back
+	dt, err := os.ReadFile(primary)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+	_, err = os.Stat(good)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWithUpdateAllLinks(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "blob")
+	alias := filepath.Join(dir, "alias")
+	require.NoError(t, os.WriteFile(name, []byte("old"), 0o600))
+	require.NoError(t, os.Link(name, alias))
+
+	// a plain commit breaks the link set: the alias keeps the old inode
+	require.NoError(t, WriteFile(name, []byte("renamed"), 0o600))
+	dt, err := os.ReadFile(alias)
+	require.NoError(t, err)
+	require.Equal(t, "old", string(dt))
+
+	// with the option, both names observe the new content
+	require.NoError(t, os.Remove(name))
+	require.NoError(t, os.Link(alias, name))
+	require.NoError(t, WriteFile(name, []byte("in place"), 0o644, WithUpdateAllLinks()))
+	for _, fn := range []string{name, alias} {
+		dt, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		require.Equal(t, "in place", string(dt))
+		fi, err := os.Stat(fn)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// with a single link the usual atomic rename happens
+	require.NoError(t, os.Remove(alias))
+	before, err := os.Stat(name)
+	require.NoError(t, err)
+	require.NoError(t, WriteFile(name, []byte("swapped"), 0o644, WithUpdateAllLinks()))
+	after, err := os.Stat(name)
+	require.NoError(t, err)
+	require.False(t, os.SameFile(before, after))
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// flockExclusive takes an exclusive advisory lock on f, blocking until it
+// is available.
+func flockExclusive(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX)
+}
+
+// flockUnlock releases a lock taken with flockExclusive.
+func flockUnlock(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,19 @@
+package atomicwriter
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// flockExclusive takes an exclusive lock on f, blocking until it is
+// available. Windows has no flock; LockFileEx on the first byte gives the
+// same whole-file advisory semantics for cooperating processes.
+func flockExclusive(f *os.File) error {
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, &windows.Overlapped{})
+}
+
+// flockUnlock releases a lock taken with flockExclusive.
+func flockUnlock(f *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,38 @@
+package atomicwriter
+
+import "os"
+
+// WriteFileAndMap atomically writes data to filename and returns a
+// read-only memory mapping of the exact content it committed, plus a
+// closer that unmaps it, for write-once-serve-many files (indexes, tables)
+// that are mapped immediately after being produced. The staged file is
+// reopened before the commit rename, so the mapping is pinned to this
+// write's inode: even if the name is replaced again right away, the
+// returned slice keeps serving these bytes.
+//
+// The slice is valid until the closer is called and must not be written
+// to; writing faults. The mapping holds the inode's storage live until
+// closed, also after later replacements unlink the name.
+func WriteFileAndMap(filename string, data []byte, perm os.FileMode) ([]byte, func() error, error) {
+	w, err := New(filename, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, nil, err
+	}
+	rf, err := os.Open(w.f.Name())
+	if err != nil {
+		w.Discard()
+		return nil, nil, err
+	}
+	defer rf.Close()
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	if len(data) == 0 {
+		return nil, func() error { return nil }, nil
+	}
+	return mapFileReadOnly(rf, len(data))
+}
@@ -0,0 +1,130 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// MappedWriter exposes a fixed-size memory-mapped temporary file for
+// random-access producers, e.g. index builders that write a header last.
+// The mapping is committed atomically to the destination with Commit, or
+// discarded with Abort.
+type MappedWriter struct {
+	data []byte
+	f    *os.File
+	fn   string
+	perm os.FileMode
+	done bool
+}
+
+// NewMapped creates a temporary file of the given size next to filename and
+// memory-maps it for random-access writes. The destination is validated up
+// front like New does.
+func NewMapped(filename string, size int64, perm os.FileMode) (*MappedWriter, error) {
+	if size <= 0 {
+		return nil, errors.New("mapped writer requires a positive size")
+	}
+	if _, err := validateDestination(filename); err != nil {
+		return nil, err
+	}
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(abspath), ".tmp-"+filepath.Base(filename))
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	data, err := unix.Mmap(int(f.Fd()), 0, int(size), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, errors.Wrap(err, "failed to mmap temp file")
+	}
+	return &MappedWriter{
+		data: data,
+		f:    f,
+		fn:   abspath,
+		perm: perm,
+	}, nil
+}
+
+// Bytes returns the mapped region backing the temporary file. It is only
+// valid until Commit or Abort is called.
+func (mw *MappedWriter) Bytes() []byte {
+	return mw.data
+}
+
+// Commit flushes the mapping to disk, unmaps it, and atomically renames the
+// temporary file over the destination. A perm of 0 keeps the temporary
+// file's 0600 mode, as with New.
+func (mw *MappedWriter) Commit() (retErr error) {
+	if mw.done {
+		return errors.New("mapped writer is already finished")
+	}
+	mw.done = true
+	defer func() {
+		if retErr != nil {
+			os.Remove(mw.f.Name())
+		}
+	}()
+	if err := unix.Msync(mw.data, unix.MS_SYNC); err != nil {
+		unix.Munmap(mw.data)
+		mw.f.Close()
+		return errors.Wrap(err, "failed to msync mapping")
+	}
+	if err := unix.Munmap(mw.data); err != nil {
+		mw.f.Close()
+		return errors.Wrap(err, "failed to munmap mapping")
+	}
+	mw.data = nil
+	if err := mw.f.Close(); err != nil {
+		return err
+	}
+	if mw.perm != 0 {
+		if err := os.Chmod(mw.f.Name(), mw.perm); err != nil {
+			return err
+		}
+	}
+	// SyncRename fsyncs the file and the destination's parent directory, so
+	// the commit is as crash-durable as the other writers in this package
+	return SyncRename(mw.f.Name(), mw.fn)
+}
+
+// mapFileReadOnly maps the first size bytes of f read-only, returning the
+// mapping and an unmap closer. The mapping outlives f's descriptor.
+func mapFileReadOnly(f *os.File, size int) ([]byte, func() error, error) {
+	data, err := unix.Mmap(int(f.Fd()), 0, size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to mmap committed file")
+	}
+	return data, func() error { return unix.Munmap(data) }, nil
+}
+
+// Abort unmaps the region and removes the temporary file, leaving the
+// destination untouched.
+func (mw *MappedWriter) Abort() error {
+	if mw.done {
+		return nil
+	}
+	mw.done = true
+	err := unix.Munmap(mw.data)
+	mw.data = nil
+	if err1 := mw.f.Close(); err == nil {
+		err = err1
+	}
+	if err1 := os.Remove(mw.f.Name()); err == nil {
+		err = err1
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedWriter(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "index.bin")
+
+	mw, err := NewMapped(fn, 16, 0o644)
+	require.NoError(t, err)
+
+	buf := mw.Bytes()
+	require.Len(t, buf, 16)
+
+	// random-access fill: body first, header last
+	copy(buf[8:], "datadata")
+	copy(buf[:8], "headerhh")
+
+	require.NoError(t, mw.Commit())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "headerhhdatadata", string(dt))
+
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+}
+
+func TestMappedWriterAbort(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "index.bin")
+
+	mw, err := NewMapped(fn, 8, 0o644)
+	require.NoError(t, err)
+	copy(mw.Bytes(), "somedata")
+	require.NoError(t, mw.Abort())
+
+	_, err = os.Stat(fn)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestWriteFileAndMap(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "index.bin")
+
+	data, unmap, err := WriteFileAndMap(fn, []byte("indexed content"), 0o644)
+	require.NoError(t, err)
+	require.Equal(t, "indexed content", string(data))
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "indexed content", string(dt))
+
+	// the mapping is pinned to the committed inode: replacing the name
+	// does not change what the slice serves
+	require.NoError(t, WriteFile(fn, []byte("replaced"), 0o644))
+	require.Equal(t, "indexed content", string(data))
+	require.NoError(t, unmap())
+
+	// empty content maps to an empty slice with a working closer
+	data, unmap, err = WriteFileAndMap(fn, nil, 0o644)
+	require.NoError(t, err)
+	require.Empty(t, data)
+	require.NoError(t, unmap())
+}
+
+func TestMappedWriterZeroPerm(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "zero.bin")
+
+	mw, err := NewMapped(fn, 4, 0)
+	require.NoError(t, err)
+	copy(mw.Bytes(), "data")
+	require.NoError(t, mw.Commit())
+
+	// perm 0 must not produce an inaccessible 000 file
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
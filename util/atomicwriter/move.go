@@ -0,0 +1,37 @@
+package atomicwriter
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCrossDevice is returned by Move when src and dst live on different
+// filesystems, where a rename cannot be atomic and the caller should fall
+// back to CopyFile.
+var ErrCrossDevice = errors.New("source and destination are on different filesystems")
+
+// Move atomically renames a fully-formed file at src over dst, applying the
+// same destination validation as New. src is fsynced and chmod-ed to perm
+// before the rename, so the destination appears durable and with its final
+// mode in one step. A perm of 0 keeps src's current mode, as with New.
+// Unlike CopyFile no data is copied, which also means src and dst must be
+// on the same filesystem.
+func Move(src, dst string, perm os.FileMode) error {
+	if _, err := validateDestination(dst); err != nil {
+		return err
+	}
+	if perm != 0 {
+		if err := os.Chmod(src, perm); err != nil {
+			return err
+		}
+	}
+	if err := SyncRename(src, dst); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return errors.Wrapf(ErrCrossDevice, "cannot move %s to %s", src, dst)
+		}
+		return err
+	}
+	return nil
+}
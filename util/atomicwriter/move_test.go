@@ -0,0 +1,52 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "built.txt")
+	dst := filepath.Join(dir, "published.txt")
+	require.NoError(t, os.WriteFile(src, []byte("content"), 0o600))
+
+	require.NoError(t, Move(src, dst, 0o644))
+
+	dt, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "content", string(dt))
+	fi, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+	_, err = os.Stat(src)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// destination validation applies
+	require.NoError(t, os.WriteFile(src, []byte("x"), 0o600))
+	err = Move(src, dir, 0o644)
+	require.ErrorIs(t, err, ErrIsDirectory)
+
+	err = Move(filepath.Join(dir, "missing"), dst, 0o644)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMoveZeroPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "built.txt")
+	dst := filepath.Join(dir, "published.txt")
+	require.NoError(t, os.WriteFile(src, []byte("content"), 0o640))
+
+	// perm 0 keeps the source's mode instead of chmod-ing to 000
+	require.NoError(t, Move(src, dst, 0))
+	fi, err := os.Stat(dst)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+}
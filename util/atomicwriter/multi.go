@@ -0,0 +1,85 @@
+package atomicwriter
+
+import (
+	stderrors "errors"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// multiWriter fans one stream out to several atomic writers, one per
+// destination.
+type multiWriter struct {
+	writers  []*Writer
+	writeErr error
+	closed   bool
+}
+
+// NewMulti returns a writer that lands one stream in every destination in
+// dests: each Write goes to one temporary file per destination (staged in
+// that destination's directory), and Close syncs and renames all of them,
+// aggregating any errors. This saves producing or copying the stream N
+// times for multi-output pipelines.
+//
+// The commit is per-destination atomic, not globally atomic: every
+// destination individually flips from old to new content in one rename,
+// but a crash or a failing destination mid-Close can leave some
+// destinations updated and others not. A write error aborts all
+// destinations; none are renamed.
+func NewMulti(dests []string, perm os.FileMode) (io.WriteCloser, error) {
+	if len(dests) == 0 {
+		return nil, errors.New("no destinations")
+	}
+	mw := &multiWriter{}
+	for _, dest := range dests {
+		w, err := New(dest, perm)
+		if err != nil {
+			for _, open := range mw.writers {
+				open.Discard()
+			}
+			return nil, errors.Wrapf(err, "destination %s", dest)
+		}
+		mw.writers = append(mw.writers, w)
+	}
+	return mw, nil
+}
+
+func (mw *multiWriter) Write(dt []byte) (int, error) {
+	if mw.writeErr != nil {
+		return 0, mw.writeErr
+	}
+	for _, w := range mw.writers {
+		if _, err := w.Write(dt); err != nil {
+			mw.writeErr = err
+			return 0, err
+		}
+	}
+	return len(dt), nil
+}
+
+// Close commits all destinations, or discards all of them if a write
+// failed. Errors from individual destinations are joined; the remaining
+// destinations are still closed so no temp files are left behind.
+func (mw *multiWriter) Close() error {
+	if mw.closed {
+		return errors.New("writer is already closed")
+	}
+	mw.closed = true
+	var errs []error
+	for _, w := range mw.writers {
+		var err error
+		if mw.writeErr != nil {
+			err = w.Discard()
+		} else {
+			err = w.Close()
+		}
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "destination %s", w.fn))
+		}
+	}
+	if mw.writeErr != nil {
+		errs = append([]error{mw.writeErr}, errs...)
+	}
+	return stderrors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMulti(t *testing.T) {
+	dir := t.TempDir()
+	dests := []string{
+		filepath.Join(dir, "out1", "manifest.json"),
+		filepath.Join(dir, "out2", "manifest.json"),
+		filepath.Join(dir, "out3", "manifest.json"),
+	}
+	for _, d := range dests {
+		require.NoError(t, os.Mkdir(filepath.Dir(d), 0o755))
+	}
+
+	w, err := NewMulti(dests, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"layers":`))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`[]}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	for _, d := range dests {
+		dt, err := os.ReadFile(d)
+		require.NoError(t, err)
+		require.Equal(t, `{"layers":[]}`, string(dt))
+		fi, err := os.Stat(d)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+	}
+
+	_, err = NewMulti(nil, 0o644)
+	require.Error(t, err)
+}
+
+func TestNewMultiInvalidDestination(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.txt")
+
+	// one bad destination aborts the whole construction without leaving
+	// temp files for the good one
+	_, err := NewMulti([]string{good, filepath.Join(dir, "missing", "bad.txt")}, 0o644)
+	require.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestNewMultiWriteError(t *testing.T) {
+	dir := t.TempDir()
+	dests := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")}
+
+	w, err := NewMulti(dests, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("partial"))
+	require.NoError(t, err)
+	// force a write error on the first underlying writer
+	mw := w.(*multiWriter)
+	mw.writeErr = os.ErrClosed
+	require.Error(t, w.Close())
+
+	// nothing was committed and no temp files remain
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,10 @@
+//go:build windows || freebsd
+
+package atomicwriter
+
+// WithODSync is a no-op where x/sys does not define O_DSYNC: the writer
+// keeps its standard commit-time fsync, so durability is unchanged and only
+// the per-write journal batching optimization is unavailable.
+func WithODSync() Option {
+	return func(w *Writer) {}
+}
@@ -0,0 +1,69 @@
+//go:build !windows && !freebsd
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithODSync(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "journal.log")
+
+	w, err := New(fn, 0o644, WithODSync())
+	require.NoError(t, err)
+	flags, err := unix.FcntlInt(w.f.Fd(), unix.F_GETFL, 0)
+	require.NoError(t, err)
+	require.NotZero(t, flags&unix.O_DSYNC, "temp fd is missing O_DSYNC")
+
+	// the explicit commit-time fsync must be skipped: the data is synced
+	// write-by-write already
+	syncs := 0
+	w.fsync = func(f *os.File) error {
+		syncs++
+		return f.Sync()
+	}
+	_, err = w.Write([]byte("entry\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.Zero(t, syncs, "commit double-synced an O_DSYNC temp file")
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "entry\n", string(dt))
+}
+
+func BenchmarkWriteFileODSync(b *testing.B) {
+	dir := b.TempDir()
+	fn := filepath.Join(dir, "bench.txt")
+	data := make([]byte, 4<<10)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"trailing-fsync", nil},
+		{"odsync", []Option{WithODSync()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				w, err := New(fn, 0o644, bc.opts...)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for j := 0; j < 4; j++ {
+					if _, err := w.Write(data); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
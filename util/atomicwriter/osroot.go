@@ -0,0 +1,128 @@
+package atomicwriter
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// rootTempSeq disambiguates concurrent temp names inside the same os.Root.
+var rootTempSeq atomic.Uint64
+
+// RootedWriter is a Writer-style io.WriteCloser whose every path operation
+// goes through an *os.Root, so resolution is confined to the root by the
+// kernel and symlink-swap or traversal tricks cannot escape it — the
+// guarantee this package's manual path validation only approximates.
+type RootedWriter struct {
+	root     *os.Root
+	f        *os.File
+	tmp      string
+	name     string
+	perm     os.FileMode
+	writeErr error
+	closed   bool
+}
+
+// NewIn returns a writer that atomically writes name, a path relative to
+// root, staging content in a temporary file inside the same root.
+func NewIn(root *os.Root, name string, perm os.FileMode) (*RootedWriter, error) {
+	if name == "" {
+		return nil, errors.New("file name is empty")
+	}
+	fi, err := root.Lstat(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, errors.Wrap(err, "failed to stat destination")
+	case fi.IsDir():
+		return nil, errors.Wrapf(ErrIsDirectory, "cannot write to %s", name)
+	case fi.Mode()&os.ModeSymlink != 0:
+		return nil, errors.Errorf("cannot write to a symbolic link directly: %s", name)
+	}
+	dir, base := filepath.Split(name)
+	var f *os.File
+	var tmp string
+	for range 10000 {
+		tmp = filepath.Join(dir, fmt.Sprintf(".tmp-%s-%d-%d", base, os.Getpid(), rootTempSeq.Add(1)))
+		f, err = root.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil || !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &RootedWriter{root: root, f: f, tmp: tmp, name: name, perm: perm}, nil
+}
+
+func (w *RootedWriter) Write(dt []byte) (int, error) {
+	n, err := w.f.Write(dt)
+	if err != nil {
+		w.writeErr = err
+	}
+	return n, err
+}
+
+// Close commits the staged content: it syncs the temporary file and renames
+// it over the destination inside the root. After a failed write the
+// temporary file is removed and the destination is left untouched. A perm
+// of 0 keeps the temporary file's 0600 mode, as with New.
+func (w *RootedWriter) Close() (retErr error) {
+	if w.closed {
+		return errors.New("writer is already closed")
+	}
+	w.closed = true
+	defer func() {
+		if retErr != nil || w.writeErr != nil {
+			w.root.Remove(w.tmp)
+		}
+	}()
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	if w.writeErr != nil {
+		return nil
+	}
+	if w.perm != 0 {
+		if err := w.root.Chmod(w.tmp, w.perm); err != nil {
+			return err
+		}
+	}
+	return w.root.Rename(w.tmp, w.name)
+}
+
+// Discard abandons the staged content without touching the destination.
+func (w *RootedWriter) Discard() error {
+	if w.closed {
+		return errors.New("writer is already closed")
+	}
+	w.closed = true
+	err := w.f.Close()
+	if rmErr := w.root.Remove(w.tmp); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// WriteFileIn atomically writes data to name, a path relative to root, with
+// the given permission bits. It is WriteFile with os.Root's traversal-safe
+// path resolution.
+func WriteFileIn(root *os.Root, name string, data []byte, perm os.FileMode) error {
+	w, err := NewIn(root, name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,72 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileIn(t *testing.T) {
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	require.NoError(t, err)
+	defer root.Close()
+
+	require.NoError(t, WriteFileIn(root, "a.txt", []byte("aaa"), 0o644))
+	dt, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "aaa", string(dt))
+	fi, err := os.Stat(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	// replacing is atomic and leaves no temp files behind
+	require.NoError(t, WriteFileIn(root, "a.txt", []byte("bbb"), 0o644))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// traversal outside the root is refused by the kernel-backed resolution
+	err = WriteFileIn(root, filepath.Join("..", "escape.txt"), []byte("x"), 0o644)
+	require.Error(t, err)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+	_, err = NewIn(root, "sub", 0o644)
+	require.ErrorIs(t, err, ErrIsDirectory)
+}
+
+func TestWriteFileInSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	dir := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+
+	root, err := os.OpenRoot(dir)
+	require.NoError(t, err)
+	defer root.Close()
+
+	err = WriteFileIn(root, filepath.Join("link", "f.txt"), []byte("x"), 0o644)
+	require.Error(t, err)
+	entries, err := os.ReadDir(outside)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestWriteFileInZeroPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+	root, err := os.OpenRoot(dir)
+	require.NoError(t, err)
+	defer root.Close()
+
+	require.NoError(t, WriteFileIn(root, "zero.txt", []byte("x"), 0))
+
+	// perm 0 must not produce an inaccessible 000 file
+	fi, err := os.Stat(filepath.Join(dir, "zero.txt"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
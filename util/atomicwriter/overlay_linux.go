@@ -0,0 +1,99 @@
+package atomicwriter
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+)
+
+// WithOverlayOptimize redirects the write into the upper layer when the
+// destination sits on an overlayfs mount and exists only in a lower layer.
+// Replacing such a file through the mount first copies the old content up
+// to the upper layer, only for the rename to discard it again; staging the
+// temp file directly in the upperdir and renaming it there skips that
+// copy-up entirely. An optimization for populating container build layers,
+// where the writer replaces the whole file and the old bytes are dead
+// weight.
+//
+// Detection is heuristic and every uncertainty falls back to the normal
+// path through the mount: the destination's filesystem must report the
+// overlayfs statfs magic, /proc/self/mountinfo must name a single overlay
+// mount covering the destination with an upperdir= option (read-only
+// overlays have none) and a root of "/", the destination must be absent
+// from the upperdir (present means it was already copied up and there is
+// nothing to save), and its parent directory must already exist there
+// (creating it would need the lower directory's ownership and xattrs
+// reproduced). Options that reason about the existing destination —
+// rotation, WithOnExisting, WithExpectInode, WithUpdateAllLinks — also
+// disable the redirect, since the upper layer hides the file they would
+// inspect.
+//
+// The redirect bypasses the overlay mount, so readers going through the
+// mount may be served stale cached entries until the overlay is remounted;
+// use it for layers whose consumers mount them afterwards, not for files
+// under concurrent access.
+func WithOverlayOptimize() Option {
+	return func(w *Writer) {
+		w.overlayOpt = true
+	}
+}
+
+// overlayUpperPath maps abspath to its location in the upperdir of the
+// overlay mount holding it, reporting ok only when every detection
+// heuristic documented on WithOverlayOptimize holds.
+func (w *Writer) overlayUpperPath(abspath string) (string, bool) {
+	if w.fsType != FSTypeOverlay {
+		return "", false
+	}
+	if w.rotateKeep > 0 || w.onExisting != nil || w.expectInode || w.updateAllLinks {
+		return "", false
+	}
+	mounts, err := mountinfo.GetMounts(func(m *mountinfo.Info) (skip, stop bool) {
+		return m.FSType != "overlay", false
+	})
+	if err != nil {
+		return "", false
+	}
+	var mount *mountinfo.Info
+	for _, m := range mounts {
+		if m.Root != "/" {
+			continue
+		}
+		if abspath != m.Mountpoint && !strings.HasPrefix(abspath, m.Mountpoint+"/") {
+			continue
+		}
+		if mount == nil || len(m.Mountpoint) > len(mount.Mountpoint) {
+			mount = m
+		}
+	}
+	if mount == nil {
+		return "", false
+	}
+	upperdir := ""
+	for _, opt := range strings.Split(mount.VFSOptions, ",") {
+		if v, ok := strings.CutPrefix(opt, "upperdir="); ok {
+			upperdir = v
+			break
+		}
+	}
+	if upperdir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(mount.Mountpoint, abspath)
+	if err != nil {
+		return "", false
+	}
+	upper := filepath.Join(upperdir, rel)
+	if _, err := os.Lstat(upper); !errors.Is(err, fs.ErrNotExist) {
+		// already copied up (or the upperdir is not visible to us)
+		return "", false
+	}
+	if fi, err := os.Lstat(filepath.Dir(upper)); err != nil || !fi.IsDir() {
+		return "", false
+	}
+	return upper, true
+}
@@ -0,0 +1,62 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithOverlayOptimize(t *testing.T) {
+	dir := t.TempDir()
+	lower := filepath.Join(dir, "lower")
+	upper := filepath.Join(dir, "upper")
+	work := filepath.Join(dir, "work")
+	merged := filepath.Join(dir, "merged")
+	for _, d := range []string{lower, upper, work, merged} {
+		require.NoError(t, os.Mkdir(d, 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(lower, "config.json"), []byte("old"), 0o644))
+
+	mountOpts := "lowerdir=" + lower + ",upperdir=" + upper + ",workdir=" + work
+	if err := unix.Mount("overlay", merged, "overlay", 0, mountOpts); err != nil {
+		t.Skipf("cannot mount overlayfs: %v", err)
+	}
+	defer unix.Unmount(merged, 0)
+
+	// a lower-only destination is staged and committed in the upper layer
+	fn := filepath.Join(merged, "config.json")
+	w, err := New(fn, 0o644, WithOverlayOptimize())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(w.f.Name(), upper+string(os.PathSeparator)), w.f.Name())
+	_, err = w.Write([]byte("new"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dt, err := os.ReadFile(filepath.Join(upper, "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "new", string(dt))
+	dt, err = os.ReadFile(filepath.Join(lower, "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, "old", string(dt))
+
+	// an already-copied-up destination goes through the mount as usual
+	w, err = New(fn, 0o644, WithOverlayOptimize())
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(w.f.Name(), merged+string(os.PathSeparator)), w.f.Name())
+	require.NoError(t, w.Discard())
+
+	// off overlayfs the option is a no-op
+	plain := filepath.Join(dir, "plain.txt")
+	w, err = New(plain, 0o644, WithOverlayOptimize())
+	require.NoError(t, err)
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	dt, err = os.ReadFile(plain)
+	require.NoError(t, err)
+	require.Equal(t, "data", string(dt))
+}
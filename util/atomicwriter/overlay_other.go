@@ -0,0 +1,8 @@
+//go:build !linux
+
+package atomicwriter
+
+// overlayUpperPath never redirects on platforms without overlayfs.
+func (w *Writer) overlayUpperPath(abspath string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,58 @@
+package atomicwriter
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// WithRateLimit throttles the data stream through the given limiter, in
+// bytes per second, to smooth bursty batch writers over congested shared
+// storage. Only Write and ReadFrom are throttled — the commit-time fsync
+// and rename are not, so the limiter shapes I/O pressure without delaying
+// the atomic swap once the content is staged. Several writers may share
+// one limiter to enforce a global budget. Use NewWithContext to make a
+// writer blocked in a rate-limit wait cancellable.
+func WithRateLimit(limiter *rate.Limiter) Option {
+	return func(w *Writer) {
+		w.limiter = limiter
+	}
+}
+
+// NewWithContext is New with a context attached to the writer. The context
+// only governs waiting — today that is the WithRateLimit wait — and
+// cancelling it fails the pending Write, which aborts the commit as any
+// write error does; it does not interrupt syscalls already in flight.
+func NewWithContext(ctx context.Context, filename string, perm os.FileMode, opts ...Option) (*Writer, error) {
+	w, err := New(filename, perm, opts...)
+	if err != nil {
+		return nil, err
+	}
+	w.ctx = ctx
+	return w, nil
+}
+
+// waitRate blocks until the limiter admits n more bytes, splitting
+// requests larger than the configured burst.
+func (w *Writer) waitRate(n int) error {
+	ctx := w.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for n > 0 {
+		burst := w.limiter.Burst()
+		if burst <= 0 {
+			// WaitN(ctx, 0) returns immediately, so looping on a zero burst
+			// would spin forever instead of surfacing the misconfiguration
+			return errors.Errorf("rate limiter burst %d cannot admit any bytes", burst)
+		}
+		chunk := min(n, burst)
+		if err := w.limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
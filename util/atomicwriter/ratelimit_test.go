@@ -0,0 +1,53 @@
+package atomicwriter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "throttled.bin")
+
+	// 1MB/s with a 32KB burst: 96KB beyond the initial burst costs ~64ms
+	limiter := rate.NewLimiter(rate.Limit(1<<20), 32<<10)
+	w, err := New(fn, 0o644, WithRateLimit(limiter))
+	require.NoError(t, err)
+	data := make([]byte, 128<<10)
+	start := time.Now()
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+	require.NoError(t, w.Close())
+	require.GreaterOrEqual(t, elapsed, 40*time.Millisecond, "write was not throttled")
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Len(t, dt, 128<<10)
+
+	// a cancelled context fails the blocked write and aborts the commit
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(nil)
+	w, err = NewWithContext(ctx, fn, 0o644, WithRateLimit(rate.NewLimiter(1, 1)))
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, w.Close()) // aborts: the destination keeps its content
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Len(t, dt, 128<<10)
+
+	// a zero-burst limiter can never admit a byte; that must be an error,
+	// not an endless spin in Write
+	w, err = New(fn, 0o644, WithRateLimit(rate.NewLimiter(1, 0)))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("x"))
+	require.ErrorContains(t, err, "cannot admit any bytes")
+	require.NoError(t, w.Close())
+}
@@ -0,0 +1,70 @@
+package atomicwriter
+
+import (
+	"encoding/binary"
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFraming is returned by WriteRecord when the existing file does
+// not consist of a sequence of well-formed length-prefixed records, so a
+// corrupted or foreign file is never extended.
+var ErrInvalidFraming = errors.New("existing content is not valid framed records")
+
+// WriteRecord atomically appends a record to a length-prefixed log file.
+// Each record is framed as a 4-byte big-endian length followed by the record
+// bytes, and the whole file is rewritten through an atomic write, so readers
+// either see the log without the new record or with it complete — never a
+// torn frame. The existing content is validated against the framing before
+// appending; a missing file starts a new log.
+func WriteRecord(filename string, record []byte, perm os.FileMode, opts ...Option) error {
+	dt, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := validateFraming(dt); err != nil {
+		return errors.Wrapf(err, "refusing to append to %s", filename)
+	}
+	buf := make([]byte, len(dt)+4+len(record))
+	copy(buf, dt)
+	binary.BigEndian.PutUint32(buf[len(dt):], uint32(len(record)))
+	copy(buf[len(dt)+4:], record)
+	return WriteFile(filename, buf, perm, opts...)
+}
+
+// ReadRecords parses a log file written by WriteRecord and returns its
+// records in order.
+func ReadRecords(filename string) ([][]byte, error) {
+	dt, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFraming(dt); err != nil {
+		return nil, errors.Wrapf(err, "failed to read records from %s", filename)
+	}
+	var records [][]byte
+	for len(dt) > 0 {
+		n := binary.BigEndian.Uint32(dt)
+		records = append(records, dt[4:4+n])
+		dt = dt[4+n:]
+	}
+	return records, nil
+}
+
+// validateFraming checks that dt is a sequence of complete length-prefixed
+// frames with no trailing garbage.
+func validateFraming(dt []byte) error {
+	for len(dt) > 0 {
+		if len(dt) < 4 {
+			return errors.Wrap(ErrInvalidFraming, "truncated length prefix")
+		}
+		n := binary.BigEndian.Uint32(dt)
+		if uint64(n) > uint64(len(dt)-4) {
+			return errors.Wrapf(ErrInvalidFraming, "record length %d exceeds remaining %d bytes", n, len(dt)-4)
+		}
+		dt = dt[4+n:]
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRecord(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "records.log")
+
+	require.NoError(t, WriteRecord(fn, []byte("first"), 0o644))
+	require.NoError(t, WriteRecord(fn, []byte(""), 0o644))
+	require.NoError(t, WriteRecord(fn, []byte("third record"), 0o644))
+
+	records, err := ReadRecords(fn)
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	require.Equal(t, "first", string(records[0]))
+	require.Empty(t, records[1])
+	require.Equal(t, "third record", string(records[2]))
+}
+
+func TestWriteRecordInvalidFraming(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "records.log")
+
+	// not framed content at all
+	require.NoError(t, os.WriteFile(fn, []byte("plain text"), 0o644))
+	err := WriteRecord(fn, []byte("x"), 0o644)
+	require.ErrorIs(t, err, ErrInvalidFraming)
+
+	// a torn frame: valid record followed by a truncated prefix
+	require.NoError(t, os.Remove(fn))
+	require.NoError(t, WriteRecord(fn, []byte("ok"), 0o644))
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(fn, append(dt, 0x00, 0x01), 0o644))
+	err = WriteRecord(fn, []byte("x"), 0o644)
+	require.ErrorIs(t, err, ErrInvalidFraming)
+
+	_, err = ReadRecords(fn)
+	require.ErrorIs(t, err, ErrInvalidFraming)
+}
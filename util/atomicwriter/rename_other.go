@@ -0,0 +1,22 @@
+//go:build !windows
+
+package atomicwriter
+
+import "os"
+
+// osRename renames oldpath over newpath. On POSIX systems rename(2) already
+// replaces the destination atomically, so this is plain os.Rename.
+func osRename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// osRenameNoReplace moves oldpath to newpath, failing with fs.ErrExist if
+// newpath already exists. rename(2) always replaces, so this links the
+// temp file under the destination name — link(2) is atomic and refuses an
+// existing target — and then removes the old name.
+func osRenameNoReplace(oldpath, newpath string) error {
+	if err := os.Link(oldpath, newpath); err != nil {
+		return err
+	}
+	return os.Remove(oldpath)
+}
@@ -0,0 +1,31 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOSRenameReplacesExisting(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "staged.txt")
+	dst := filepath.Join(dir, "dest.txt")
+	require.NoError(t, os.WriteFile(src, []byte("new"), 0o644))
+	require.NoError(t, os.WriteFile(dst, []byte("old"), 0o644))
+
+	require.NoError(t, osRename(src, dst))
+
+	dt, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(dt))
+	_, err = os.Stat(src)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// the write-through commit path is what Close uses end to end
+	require.NoError(t, WriteFile(dst, []byte("replaced"), 0o644))
+	dt, err = os.ReadFile(dst)
+	require.NoError(t, err)
+	require.Equal(t, "replaced", string(dt))
+}
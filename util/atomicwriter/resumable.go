@@ -0,0 +1,116 @@
+package atomicwriter
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ResumableWriter is a Writer variant for huge downloads that must survive
+// a process restart: instead of a random temporary name it stages content
+// under a deterministic name derived from the destination, so a new writer
+// for the same destination picks up where a crashed one stopped. Offset
+// reports how many bytes are already staged; the caller resumes producing
+// from there and appends the rest. Commit renames the staged file into
+// place as usual; Abort removes it.
+//
+// The deterministic name means at most one resumable writer per
+// destination may be live at a time — a second one appends to the same
+// file and corrupts it. The package also cannot know whether the partial
+// content from the previous run is intact; callers should verify the
+// committed result against an expected digest, e.g. by hashing the staged
+// content (see WithTee on the plain Writer) or a post-commit checksum.
+type ResumableWriter struct {
+	f        *os.File
+	fn       string
+	perm     os.FileMode
+	offset   int64
+	done     bool
+	writeErr error
+}
+
+// NewResumable returns a ResumableWriter for filename, reopening and
+// appending to a staged file left behind by an earlier writer for the same
+// destination if one exists.
+func NewResumable(filename string, perm os.FileMode) (*ResumableWriter, error) {
+	if err := validatePerm(perm, false); err != nil {
+		return nil, err
+	}
+	if _, err := validateDestination(filename); err != nil {
+		return nil, err
+	}
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(filepath.Dir(abspath), ".tmp-resume-"+filepath.Base(abspath))
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ResumableWriter{f: f, fn: abspath, perm: perm, offset: offset}, nil
+}
+
+// Offset reports how many bytes were already staged when the writer was
+// opened, i.e. where the caller should resume producing content.
+func (w *ResumableWriter) Offset() int64 {
+	return w.offset
+}
+
+// Write appends to the staged file.
+func (w *ResumableWriter) Write(dt []byte) (int, error) {
+	n, err := w.f.Write(dt)
+	if err != nil {
+		w.writeErr = err
+	}
+	return n, err
+}
+
+// Commit syncs the staged file and atomically renames it over the
+// destination. Unlike a failed plain Writer, a ResumableWriter whose write
+// failed leaves the staged file in place, so the next attempt can resume.
+func (w *ResumableWriter) Commit() error {
+	if w.done {
+		return errors.New("writer is already committed or aborted")
+	}
+	w.done = true
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	if w.writeErr != nil {
+		// keep the staged file for the next attempt
+		return errors.Wrap(w.writeErr, "write failed, staged file kept for resume")
+	}
+	if w.perm != 0 {
+		if err := os.Chmod(w.f.Name(), w.perm); err != nil {
+			return err
+		}
+	}
+	return SyncRename(w.f.Name(), w.fn)
+}
+
+// Close implements io.Closer as an alias for Commit.
+func (w *ResumableWriter) Close() error {
+	return w.Commit()
+}
+
+// Abort discards the staged content, including whatever a previous run had
+// staged, without touching the destination.
+func (w *ResumableWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	err := w.f.Close()
+	if rmErr := os.Remove(w.f.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumableWriter(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "download.bin")
+
+	// first attempt writes half and "crashes" (writer abandoned uncommitted)
+	w, err := NewResumable(fn, 0o644)
+	require.NoError(t, err)
+	require.Zero(t, w.Offset())
+	_, err = w.Write([]byte("first half "))
+	require.NoError(t, err)
+	require.NoError(t, w.f.Close())
+
+	// the second attempt resumes where the first stopped
+	w, err = NewResumable(fn, 0o644)
+	require.NoError(t, err)
+	require.Equal(t, int64(len("first half ")), w.Offset())
+	_, err = w.Write([]byte("second half"))
+	require.NoError(t, err)
+	require.NoError(t, w.Commit())
+
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "first half second half", string(dt))
+	fi, err := os.Stat(fn)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+
+	// no staged file is left after the commit
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestResumableWriterAbort(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "download.bin")
+
+	w, err := NewResumable(fn, 0o644)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("partial"))
+	require.NoError(t, err)
+	require.NoError(t, w.Abort())
+
+	// Abort removed the staged file, so a new writer starts from scratch
+	w, err = NewResumable(fn, 0o644)
+	require.NoError(t, err)
+	require.Zero(t, w.Offset())
+	require.NoError(t, w.Abort())
+	_, err = os.Stat(fn)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
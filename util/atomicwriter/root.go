@@ -0,0 +1,65 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Root confines atomic writes to a base directory. Logical destination
+// paths, absolute or relative, are joined under the base, and paths that
+// would escape it via ".." are rejected. This is the "safe write into a
+// subtree" primitive for materializing files with absolute logical paths
+// (e.g. /etc/foo) under a staging root (e.g. /build/rootfs/etc/foo).
+type Root struct {
+	base string
+}
+
+// NewRoot returns a Root writing under base, which must be an existing
+// directory.
+func NewRoot(base string) (*Root, error) {
+	abs, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid root")
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("root %s is not a directory", base)
+	}
+	return &Root{base: abs}, nil
+}
+
+// join maps a logical path to its location under the root, rejecting paths
+// that escape it.
+func (r *Root) join(name string) (string, error) {
+	joined := filepath.Join(r.base, filepath.FromSlash(name))
+	if joined != r.base && !strings.HasPrefix(joined, r.base+string(filepath.Separator)) {
+		return "", errors.Errorf("path %s escapes the root %s", name, r.base)
+	}
+	return joined, nil
+}
+
+// New returns a Writer for the logical path name materialized under the
+// root. It otherwise behaves like the top-level New.
+func (r *Root) New(name string, perm os.FileMode, opts ...Option) (*Writer, error) {
+	fn, err := r.join(name)
+	if err != nil {
+		return nil, err
+	}
+	return New(fn, perm, opts...)
+}
+
+// WriteFile atomically writes data to the logical path name materialized
+// under the root. It otherwise behaves like the top-level WriteFile.
+func (r *Root) WriteFile(name string, data []byte, perm os.FileMode, opts ...Option) error {
+	fn, err := r.join(name)
+	if err != nil {
+		return err
+	}
+	return WriteFile(fn, data, perm, opts...)
+}
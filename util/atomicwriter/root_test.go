@@ -0,0 +1,46 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoot(t *testing.T) {
+	base := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "etc"), 0o755))
+
+	r, err := NewRoot(base)
+	require.NoError(t, err)
+
+	// absolute logical paths are materialized under the base
+	require.NoError(t, r.WriteFile("/etc/foo", []byte("cfg"), 0o644))
+	dt, err := os.ReadFile(filepath.Join(base, "etc", "foo"))
+	require.NoError(t, err)
+	require.Equal(t, "cfg", string(dt))
+
+	// relative paths work the same way
+	require.NoError(t, r.WriteFile("etc/bar", []byte("cfg2"), 0o644))
+	_, err = os.Stat(filepath.Join(base, "etc", "bar"))
+	require.NoError(t, err)
+
+	// escapes are rejected
+	err = r.WriteFile("../escape", []byte("x"), 0o644)
+	require.ErrorContains(t, err, "escapes the root")
+	err = r.WriteFile("/etc/../../escape", []byte("x"), 0o644)
+	require.ErrorContains(t, err, "escapes the root")
+}
+
+func TestNewRootValidation(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewRoot(filepath.Join(dir, "missing"))
+	require.ErrorContains(t, err, "invalid root")
+
+	fn := filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(fn, []byte("x"), 0o644))
+	_, err = NewRoot(fn)
+	require.ErrorContains(t, err, "not a directory")
+}
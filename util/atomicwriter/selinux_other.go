@@ -0,0 +1,9 @@
+//go:build !linux
+
+package atomicwriter
+
+// applySELinux is a no-op outside Linux; the SELinux options are only
+// built there.
+func (w *Writer) applySELinux(tempPath string) error {
+	return nil
+}
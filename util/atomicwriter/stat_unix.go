@@ -0,0 +1,65 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// DevIno returns the device and inode numbers of fi, as returned by
+// Writer.Stat, so callers can key content-addressed dedup on
+// (device, inode) and hardlink future identical writes.
+func DevIno(fi os.FileInfo) (dev, ino uint64, err error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, errors.Errorf("unsupported stat type %T", fi.Sys())
+	}
+	return uint64(st.Dev), uint64(st.Ino), nil //nolint:unconvert // Dev and Ino are 32-bit on some platforms
+}
+
+// WithExpectInode makes Close fail with ErrInodeChanged unless the
+// destination still carries the given device/inode pair right before the
+// commit rename, for read-modify-write cycles that must not clobber a
+// concurrent replacement. It is a cheaper, lower-level counterpart of
+// content-hash CAS (see WriteFileCAS), and like it is best-effort: the
+// window between the check and the rename remains. Unix-only; Windows has
+// no stable inode semantics to compare against.
+func WithExpectInode(dev, ino uint64) Option {
+	return func(w *Writer) {
+		w.expectInode = true
+		w.expectDev = dev
+		w.expectIno = ino
+	}
+}
+
+// fileOwner extracts the uid/gid of fi's owner, for recreating a directory
+// with the same ownership.
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	st, sok := fi.Sys().(*syscall.Stat_t)
+	if !sok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// fileNlink reports how many hardlinks share fi's inode.
+func fileNlink(fi os.FileInfo) uint64 {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 1
+	}
+	return uint64(st.Nlink) //nolint:unconvert // Nlink is 16-bit on some platforms
+}
+
+// casOptions derives the inode-CAS precondition Update guards its commit
+// with from the FileInfo observed before the read.
+func casOptions(fi os.FileInfo) []Option {
+	dev, ino, err := DevIno(fi)
+	if err != nil {
+		return nil
+	}
+	return []Option{WithExpectInode(dev, ino)}
+}
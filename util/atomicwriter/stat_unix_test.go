@@ -0,0 +1,64 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestWithExpectInode(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "coordinated.txt")
+	require.NoError(t, os.WriteFile(fn, []byte("v1"), 0o644))
+
+	fi, err := os.Lstat(fn)
+	require.NoError(t, err)
+	dev, ino, err := DevIno(fi)
+	require.NoError(t, err)
+
+	// nobody replaced the file: the write goes through
+	require.NoError(t, WriteFile(fn, []byte("v2"), 0o644, WithExpectInode(dev, ino)))
+
+	// the previous write replaced the inode, so the stale expectation fails
+	err = WriteFile(fn, []byte("v3"), 0o644, WithExpectInode(dev, ino))
+	require.ErrorIs(t, err, ErrInodeChanged)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(dt))
+
+	// a removed destination counts as changed too
+	require.NoError(t, os.Remove(fn))
+	err = WriteFile(fn, []byte("v3"), 0o644, WithExpectInode(dev, ino))
+	require.ErrorIs(t, err, ErrInodeChanged)
+
+	// no temp files are left behind by the aborted commits
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "quota.txt")
+
+	w, err := New(fn, 0o644)
+	require.NoError(t, err)
+	w.fsync = func(f *os.File) error {
+		return unix.EDQUOT
+	}
+	_, err = w.Write([]byte("x"))
+	require.NoError(t, err)
+	err = w.Close()
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.ErrorIs(t, err, unix.EDQUOT)
+
+	// no temp file is left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,32 @@
+package atomicwriter
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// DevIno is not supported on Windows, which has no stable device/inode
+// identity exposed through os.FileInfo.
+func DevIno(fi os.FileInfo) (dev, ino uint64, err error) {
+	return 0, 0, errors.New("device and inode numbers are not available on windows")
+}
+
+// fileOwner is not supported on Windows; directory ownership is left to
+// inheritance from the parent.
+func fileOwner(fi os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// fileNlink always reports 1 on Windows: link counts are not exposed
+// through os.FileInfo, and hardlink aliasing is rare enough there that the
+// in-place update path simply never triggers.
+func fileNlink(fi os.FileInfo) uint64 {
+	return 1
+}
+
+// casOptions returns no options on Windows: without stable inode identity
+// Update cannot carry an inode-CAS precondition, and the last writer wins.
+func casOptions(fi os.FileInfo) []Option {
+	return nil
+}
@@ -0,0 +1,41 @@
+//go:build openbsd
+
+package atomicwriter
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// checkFreeInodes returns ErrNoInodes when the filesystem holding dir has no
+// free inodes left; see statfs_unix.go. OpenBSD's Statfs_t carries the same
+// counters under F_-prefixed names.
+func checkFreeInodes(dir string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return nil
+	}
+	if st.F_files > 0 && st.F_ffree == 0 {
+		return errors.Wrapf(ErrNoInodes, "cannot create temporary file in %s", dir)
+	}
+	return nil
+}
+
+// freeBytes returns the free space (for unprivileged users) on the
+// filesystem holding dir. ok is false when statfs fails, in which case the
+// caller skips its check.
+func freeBytes(dir string) (free uint64, ok bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	if st.F_bavail < 0 {
+		return 0, true
+	}
+	return uint64(st.F_bavail) * uint64(st.F_bsize), true
+}
+
+// isQuotaErr reports whether err is a disk-quota failure (EDQUOT).
+func isQuotaErr(err error) bool {
+	return errors.Is(err, unix.EDQUOT)
+}
@@ -0,0 +1,38 @@
+//go:build netbsd || solaris
+
+package atomicwriter
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// checkFreeInodes returns ErrNoInodes when the filesystem holding dir has no
+// free inodes left; see statfs_unix.go. NetBSD and Solaris expose the
+// counters through statvfs rather than statfs.
+func checkFreeInodes(dir string) error {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(dir, &st); err != nil {
+		return nil
+	}
+	if st.Files > 0 && st.Ffree == 0 {
+		return errors.Wrapf(ErrNoInodes, "cannot create temporary file in %s", dir)
+	}
+	return nil
+}
+
+// freeBytes returns the free space (for unprivileged users) on the
+// filesystem holding dir. ok is false when statvfs fails, in which case the
+// caller skips its check.
+func freeBytes(dir string) (free uint64, ok bool) {
+	var st unix.Statvfs_t
+	if err := unix.Statvfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return st.Bavail * st.Frsize, true
+}
+
+// isQuotaErr reports whether err is a disk-quota failure (EDQUOT).
+func isQuotaErr(err error) bool {
+	return errors.Is(err, unix.EDQUOT)
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !netbsd && !openbsd && !solaris
+
+package atomicwriter
+
+import (
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// checkFreeInodes returns ErrNoInodes when the filesystem holding dir has no
+// free inodes left. Without this check, creating the temporary file fails
+// with a bare ENOSPC that is indistinguishable from running out of bytes.
+// Filesystems that do not track inode counts (and statfs failures) pass the
+// check; the subsequent file creation reports any real problem.
+func checkFreeInodes(dir string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return nil
+	}
+	if st.Files > 0 && st.Ffree == 0 {
+		return errors.Wrapf(ErrNoInodes, "cannot create temporary file in %s", dir)
+	}
+	return nil
+}
+
+// freeBytes returns the free space (for unprivileged users) on the
+// filesystem holding dir. ok is false when statfs fails, in which case the
+// caller skips its check.
+func freeBytes(dir string) (free uint64, ok bool) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), true //nolint:unconvert // Bavail and Bsize types differ between platforms
+}
+
+// isQuotaErr reports whether err is a disk-quota failure (EDQUOT).
+func isQuotaErr(err error) bool {
+	return errors.Is(err, unix.EDQUOT)
+}
@@ -0,0 +1,30 @@
+package atomicwriter
+
+import "golang.org/x/sys/windows"
+
+// checkFreeInodes is a no-op on Windows, which has no statfs-style inode
+// accounting to query.
+func checkFreeInodes(dir string) error {
+	return nil
+}
+
+// freeBytes returns the free space available to the calling user on the
+// volume holding dir. ok is false when the query fails, in which case the
+// caller skips its check.
+func freeBytes(dir string) (free uint64, ok bool) {
+	dirp, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false
+	}
+	var avail, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(dirp, &avail, &total, &totalFree); err != nil {
+		return 0, false
+	}
+	return avail, true
+}
+
+// isQuotaErr reports whether err is a disk-quota failure. Windows reports
+// quota exhaustion as generic out-of-space, so there is nothing to detect.
+func isQuotaErr(err error) bool {
+	return false
+}
@@ -0,0 +1,56 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// SyncRename is the bare durability primitive the writers in this package
+// are built on: it fsyncs tempPath, renames it over destPath, and fsyncs
+// destPath's parent directory so the rename itself survives a crash.
+// Callers that already have a fully-written temporary file can use it
+// directly instead of going through the io.WriteCloser flow; destination
+// validation and permission handling remain their responsibility.
+func SyncRename(tempPath, destPath string) error {
+	f, err := os.Open(tempPath)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := osRename(tempPath, destPath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(destPath))
+}
+
+// syncDir fsyncs a directory so a rename of one of its entries is durable.
+// Windows does not support syncing directory handles; there the rename's
+// durability is left to the filesystem, as it was before this helper.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if err1 := d.Close(); err == nil {
+		err = err1
+	}
+	// FAT-family filesystems have no directory fsync; not a failure
+	if errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,51 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Touch atomically creates an empty file at filename with exactly the
+// given permission bits, without the full writer ceremony. It is intended
+// for sentinel and lock-marker files.
+//
+// When exclusive is true, Touch fails with an error matching fs.ErrExist
+// if the destination already exists, making it usable as a create-once
+// marker. When exclusive is false and the destination exists, Touch
+// replaces it with a fresh empty file: the mtime is updated atomically,
+// but any existing content is discarded — it is a sentinel primitive, not
+// a POSIX touch(1).
+func Touch(filename string, perm os.FileMode, exclusive bool) error {
+	filename = rewritePath(filename)
+	if err := validatePerm(perm, false); err != nil {
+		return err
+	}
+	if _, err := validateDestination(filename); err != nil {
+		return err
+	}
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(abspath), ".tmp-"+filepath.Base(abspath))
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	err = f.Chmod(perm)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if exclusive {
+			err = osRenameNoReplace(tmp, abspath)
+		} else {
+			err = osRename(tmp, abspath)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(abspath))
+}
@@ -0,0 +1,44 @@
+package atomicwriter
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTouch(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ready")
+
+	require.NoError(t, Touch(marker, 0o600, true))
+	fi, err := os.Stat(marker)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	require.Zero(t, fi.Size())
+
+	// exclusive refuses an existing destination and leaves no temp files
+	err = Touch(marker, 0o600, true)
+	require.ErrorIs(t, err, fs.ErrExist)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// non-exclusive replaces, updating the mtime and discarding content
+	require.NoError(t, os.WriteFile(marker, []byte("stale"), 0o600))
+	require.NoError(t, os.Chtimes(marker, time.Time{}, time.Now().Add(-time.Hour)))
+	before, err := os.Stat(marker)
+	require.NoError(t, err)
+	require.NoError(t, Touch(marker, 0o644, false))
+	fi, err = os.Stat(marker)
+	require.NoError(t, err)
+	require.Zero(t, fi.Size())
+	require.Equal(t, os.FileMode(0o644), fi.Mode().Perm())
+	require.True(t, fi.ModTime().After(before.ModTime()))
+
+	require.Error(t, Touch(dir, 0o600, false))
+	require.Error(t, Touch(marker, os.ModeSymlink|0o600, true))
+}
@@ -0,0 +1,59 @@
+package atomicwriter
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// Update atomically applies a read-modify-write cycle to filename: the
+// current content (nil if the file does not exist) is passed to transform,
+// and its result is written back atomically. An error from transform aborts
+// the update without touching the file.
+//
+// Concurrent updates to the same file are detected through the inode-CAS
+// precondition (see WithExpectInode): if another writer replaced or created
+// the file between the read and the commit, Update fails with
+// ErrInodeChanged and the caller retries the whole cycle:
+//
+//	for {
+//		err := atomicwriter.Update(fn, 0o644, bump)
+//		if !errors.Is(err, atomicwriter.ErrInodeChanged) {
+//			return err
+//		}
+//	}
+//
+// On platforms without stable inode semantics the precondition is skipped
+// and the last writer wins.
+func Update(filename string, perm os.FileMode, transform func(current []byte) ([]byte, error)) error {
+	var (
+		opts    []Option
+		current []byte
+	)
+	fi, err := os.Lstat(filename)
+	switch {
+	case err == nil:
+		current, err = os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		opts = casOptions(fi)
+	case errors.Is(err, fs.ErrNotExist):
+		// the file must still be absent at commit time, so a concurrent
+		// creation surfaces as ErrInodeChanged just like a replacement
+		opts = append(opts, WithOnExisting(func(existing os.FileInfo) (Action, error) {
+			if existing != nil {
+				return Abort, errors.Wrap(ErrInodeChanged, "destination appeared during update")
+			}
+			return Overwrite, nil
+		}))
+	default:
+		return err
+	}
+	next, err := transform(current)
+	if err != nil {
+		return errors.Wrap(err, "transform")
+	}
+	return WriteFile(filename, next, perm, opts...)
+}
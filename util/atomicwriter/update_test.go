@@ -0,0 +1,84 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "counter")
+
+	// a missing file hands nil to the transform
+	err := Update(fn, 0o644, func(current []byte) ([]byte, error) {
+		require.Nil(t, current)
+		return []byte("1"), nil
+	})
+	require.NoError(t, err)
+
+	// an existing file is read, transformed and written back
+	err = Update(fn, 0o644, func(current []byte) ([]byte, error) {
+		n, err := strconv.Atoi(string(current))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(n + 1)), nil
+	})
+	require.NoError(t, err)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "2", string(dt))
+
+	// a transform error aborts the update and keeps the file intact
+	transformErr := errors.New("bad content")
+	err = Update(fn, 0o644, func(current []byte) ([]byte, error) {
+		return nil, transformErr
+	})
+	require.ErrorIs(t, err, transformErr)
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "2", string(dt))
+}
+
+func TestUpdateConcurrentModification(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "contended")
+	require.NoError(t, os.WriteFile(fn, []byte("base"), 0o644))
+
+	// another writer replaces the file between the read and the commit
+	err := Update(fn, 0o644, func(current []byte) ([]byte, error) {
+		require.NoError(t, WriteFile(fn, []byte("interloper"), 0o644))
+		return append(current, " updated"...), nil
+	})
+	require.ErrorIs(t, err, ErrInodeChanged)
+	dt, err := os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "interloper", string(dt))
+
+	// a concurrent creation of a previously missing file is detected too
+	require.NoError(t, os.Remove(fn))
+	err = Update(fn, 0o644, func(current []byte) ([]byte, error) {
+		require.NoError(t, WriteFile(fn, []byte("interloper"), 0o644))
+		return []byte("fresh"), nil
+	})
+	require.ErrorIs(t, err, ErrInodeChanged)
+
+	// the retry loop from the doc comment converges
+	for range 3 {
+		err = Update(fn, 0o644, func(current []byte) ([]byte, error) {
+			return append(current, '!'), nil
+		})
+		if !errors.Is(err, ErrInodeChanged) {
+			break
+		}
+	}
+	require.NoError(t, err)
+	dt, err = os.ReadFile(fn)
+	require.NoError(t, err)
+	require.Equal(t, "interloper!", string(dt))
+}
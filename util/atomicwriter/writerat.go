@@ -0,0 +1,104 @@
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// AtomicWriterAt is an io.WriterAt staging content in a temporary file, for
+// producers that write at computed offsets (e.g. a tar stream with a
+// back-patched header) and cannot use the sequential Writer. Commit makes
+// the content visible atomically; Abort discards it. It is the
+// syscall-based counterpart of MappedWriter for callers that prefer not to
+// mmap.
+type AtomicWriterAt struct {
+	f    *os.File
+	fn   string
+	perm os.FileMode
+	// mu guards size: the io.WriterAt contract permits parallel WriteAt
+	// calls on non-overlapping ranges, so the extent tracking must be
+	// synchronized even though the file writes themselves need not be.
+	mu sync.Mutex
+	// size is the largest offset+len written so far, which determines the
+	// committed file's size regardless of write order.
+	size int64
+	done bool
+}
+
+// NewWriterAt returns an AtomicWriterAt staging content for filename in a
+// temporary file in the destination directory.
+func NewWriterAt(filename string, perm os.FileMode) (*AtomicWriterAt, error) {
+	if _, err := validateDestination(filename); err != nil {
+		return nil, err
+	}
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(abspath), ".tmp-"+filepath.Base(filename))
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicWriterAt{f: f, fn: abspath, perm: perm}, nil
+}
+
+// WriteAt writes len(p) bytes at offset off in the staged file. Writes may
+// arrive in any order, may overlap, and may run in parallel as io.WriterAt
+// allows; unwritten gaps read as zero bytes in the committed file.
+func (w *AtomicWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.f.WriteAt(p, off)
+	if end := off + int64(n); end > 0 {
+		w.mu.Lock()
+		if end > w.size {
+			w.size = end
+		}
+		w.mu.Unlock()
+	}
+	return n, err
+}
+
+// Commit truncates the staged file to the written extent, syncs it, and
+// atomically renames it over the destination. A perm of 0 keeps the
+// temporary file's 0600 mode, as with New.
+func (w *AtomicWriterAt) Commit() error {
+	if w.done {
+		return errors.New("writer is already committed or aborted")
+	}
+	w.done = true
+	if err := w.f.Truncate(w.size); err != nil {
+		w.f.Close()
+		os.Remove(w.f.Name())
+		return err
+	}
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	if w.perm != 0 {
+		if err := os.Chmod(w.f.Name(), w.perm); err != nil {
+			os.Remove(w.f.Name())
+			return err
+		}
+	}
+	if err := SyncRename(w.f.Name(), w.fn); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the staged content without touching the destination.
+func (w *AtomicWriterAt) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	err := w.f.Close()
+	if rmErr := os.Remove(w.f.Name()); rmErr != nil && err == nil {
+		err = rmErr
+	}
+	return err
+}
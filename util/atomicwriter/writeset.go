@@ -0,0 +1,828 @@
+package atomicwriter
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// liveSets tracks the staging roots of all write sets that have not been
+// committed or cancelled yet, so Commit can reject targets that would end
+// up inside another in-flight set.
+var (
+	liveSetsMu sync.Mutex
+	liveSets   = map[string]struct{}{}
+)
+
+func registerSet(root string) {
+	liveSetsMu.Lock()
+	liveSets[root] = struct{}{}
+	liveSetsMu.Unlock()
+}
+
+func unregisterSet(root string) {
+	liveSetsMu.Lock()
+	delete(liveSets, root)
+	liveSetsMu.Unlock()
+}
+
+// checkCommitTarget returns an error if target is the staging root of, or
+// located inside, any live write set.
+func checkCommitTarget(target string) error {
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+	liveSetsMu.Lock()
+	defer liveSetsMu.Unlock()
+	for root := range liveSets {
+		if abs == root {
+			return errors.Errorf("commit target %s is the staging root of a live write set", target)
+		}
+		if strings.HasPrefix(abs, root+string(filepath.Separator)) {
+			return errors.Errorf("commit target %s is inside the staging root of a live write set (%s)", target, root)
+		}
+	}
+	return nil
+}
+
+// WriteSetOption configures a WriteSet created by NewWriteSet.
+type WriteSetOption func(*WriteSet)
+
+// WithRootMode sets the mode the staging root is chmod-ed to right before
+// Commit renames it into place. Without it, the committed directory
+// inherits os.MkdirTemp's restrictive 0700 mode, which is usually too tight
+// for shared asset directories, and callers would have to chmod the target
+// after the fact, racing with readers.
+func WithRootMode(perm os.FileMode) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.rootMode = perm
+	}
+}
+
+// WithDirMode sets the permission bits applied to intermediate directories
+// created while staging files with nested paths. The default is 0755.
+func WithDirMode(perm os.FileMode) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.dirMode = perm
+	}
+}
+
+// WithUmask masks the permission bits of intermediate directories created
+// while staging (perm &^ umask), so staged trees follow the same policy as
+// directories created by other tools on the host. Without it the configured
+// WithDirMode is applied verbatim, deliberately ignoring the process umask.
+func WithUmask(umask os.FileMode) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.umask = umask
+	}
+}
+
+// WithDirOwner sets the owner applied to intermediate directories created
+// while staging files with nested paths, e.g. when exporting a rootfs. It
+// has no effect on Windows.
+func WithDirOwner(uid, gid int) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.dirUID = uid
+		ws.dirGID = gid
+	}
+}
+
+// WithConcurrency parallelizes the per-file copies of a copy-based commit
+// (see CommitContext) across n goroutines, for large trees committed to
+// high-latency targets such as network filesystems. Directories are still
+// created up front in parent-before-child order; only regular file copies
+// run concurrently. n <= 1 keeps the sequential behavior.
+func WithConcurrency(n int) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.concurrency = n
+	}
+}
+
+// WithBufferSize sets the buffer size the set uses when it copies or
+// hashes file contents (the commit-copy fallback, Verify); it is the
+// write-set counterpart of the Writer's WithCopyBufferSize, with the same
+// pooling and the same 32KB default.
+func WithBufferSize(n int) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.copyBufSize = n
+	}
+}
+
+// WithCommitRetry retries the commit rename a bounded number of times when
+// it fails with a transient EBUSY, sleeping backoff between attempts. This
+// is the write-set counterpart of the Writer's WithRenameRetry; see there
+// for the overlayfs background.
+func WithCommitRetry(attempts int, backoff time.Duration) WriteSetOption {
+	return func(ws *WriteSet) {
+		ws.renameRetries = attempts
+		ws.renameBackoff = backoff
+	}
+}
+
+// WriteSet is used to atomically write a set of files and make them visible
+// at the same time. Files are staged under a temporary root directory, and
+// Commit renames that root to the target directory, which must not exist
+// yet.
+type WriteSet struct {
+	root          string
+	rootMode      os.FileMode
+	dirMode       os.FileMode
+	umask         os.FileMode
+	dirUID        int
+	dirGID        int
+	renameRetries int
+	renameBackoff time.Duration
+	concurrency   int
+	copyBufSize   int
+
+	// copyFile is a seam for tests to instrument per-file copies; nil means
+	// copyFileContents.
+	copyFile func(dst, src string, perm os.FileMode) error
+}
+
+// NewWriteSet creates a new atomic write set to write many files to the
+// same directory atomically. The staging root is created inside tmpDir,
+// which should be on the same filesystem as the eventual commit target so
+// the commit rename does not cross devices.
+func NewWriteSet(tmpDir string, opts ...WriteSetOption) (*WriteSet, error) {
+	td, err := os.MkdirTemp(tmpDir, "write-set-")
+	if err != nil {
+		return nil, err
+	}
+	ws := &WriteSet{
+		root:    td,
+		dirMode: 0o755,
+		dirUID:  -1,
+		dirGID:  -1,
+	}
+	for _, opt := range opts {
+		opt(ws)
+	}
+	registerSet(td)
+	return ws, nil
+}
+
+// OpenWriteSet re-attaches to an existing staging root created by an
+// earlier NewWriteSet, so an interrupted staging operation can be resumed
+// after a crash and then committed. root must be an existing directory that
+// looks like a staging root (a write-set-* directory).
+func OpenWriteSet(root string, opts ...WriteSetOption) (*WriteSet, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid staging root")
+	}
+	if !fi.IsDir() {
+		return nil, errors.Errorf("staging root %s is not a directory", root)
+	}
+	if !strings.HasPrefix(filepath.Base(abs), "write-set-") {
+		return nil, errors.Errorf("%s does not look like a staging root", root)
+	}
+	ws := &WriteSet{
+		root:    abs,
+		dirMode: 0o755,
+		dirUID:  -1,
+		dirGID:  -1,
+	}
+	for _, opt := range opts {
+		opt(ws)
+	}
+	registerSet(abs)
+	return ws, nil
+}
+
+// WriteFile writes a file inside the set with the given name and permission
+// bits.
+func (ws *WriteSet) WriteFile(filename string, data []byte, perm os.FileMode) error {
+	f, err := ws.FileWriter(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	n, err := f.Write(data)
+	if err == nil && n < len(data) {
+		err = io.ErrShortWrite
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+type syncFileCloser struct {
+	*os.File
+}
+
+func (w syncFileCloser) Close() error {
+	err := w.File.Sync()
+	if err1 := w.File.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// FileWriter opens a file writer inside the set, creating intermediate
+// directories as needed (see WithDirMode and WithDirOwner). The file is
+// synced on Close to ensure it is flushed to disk before the set is
+// committed.
+func (ws *WriteSet) FileWriter(name string, flag int, perm os.FileMode) (io.WriteCloser, error) {
+	if err := ws.mkdirParents(name); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(ws.root, name), flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return syncFileCloser{f}, nil
+}
+
+// mkdirParents creates the missing intermediate directories for name inside
+// the staging root one component at a time, so the configured directory
+// mode and owner are only applied to directories this set creates.
+func (ws *WriteSet) mkdirParents(name string) error {
+	rel, err := relStagingDir(ws.root, name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return nil
+	}
+	mode := ws.dirMode &^ ws.umask
+	path := ws.root
+	for _, comp := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, comp)
+		if err := os.Mkdir(path, mode); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				// another goroutine may have created it concurrently; make
+				// sure what exists is actually a directory and not a file
+				// or symlink racing us
+				fi, lerr := os.Lstat(path)
+				if lerr != nil {
+					return lerr
+				}
+				if !fi.IsDir() {
+					return errors.Errorf("staging path %s exists and is not a directory", path)
+				}
+				continue
+			}
+			return err
+		}
+		if ws.dirUID >= 0 || ws.dirGID >= 0 {
+			if err := os.Chown(path, ws.dirUID, ws.dirGID); err != nil {
+				return err
+			}
+		}
+		// Mkdir is subject to the process umask; apply the computed mode
+		// explicitly so only the configured WithUmask is honored
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relStagingDir returns the parent directory of name relative to the staging
+// root, or "" if name sits directly in the root. Names whose parent resolves
+// outside the root are rejected. It is a pure path computation, kept separate
+// from mkdirParents so the traversal check can be exercised (and fuzzed)
+// without touching the filesystem.
+func relStagingDir(root, name string) (string, error) {
+	dir := filepath.Dir(filepath.Join(root, name))
+	if dir == root {
+		return "", nil
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("file name %s escapes the staging root", name)
+	}
+	return rel, nil
+}
+
+// AddExisting pulls an existing file from disk into the set under name,
+// preserving its permission bits. The cheapest available mechanism is used:
+// a reflink clone when the filesystem supports it, else a hardlink, else a
+// full copy. Note that the hardlink fallback shares the inode with srcPath,
+// so the staged entry reflects writes made to srcPath before the set is
+// committed; sources that may still be modified should be staged with
+// WriteFile instead. name is subject to the same traversal checks as
+// WriteFile.
+func (ws *WriteSet) AddExisting(name, srcPath string) error {
+	if err := ws.mkdirParents(name); err != nil {
+		return err
+	}
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Errorf("cannot add %s to write set: not a regular file", srcPath)
+	}
+	dest := filepath.Join(ws.root, name)
+	sf, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if cloneFile(df, sf) {
+		return df.Close()
+	}
+	// no reflink support: a hardlink still avoids duplicating the data
+	df.Close()
+	if err := os.Remove(dest); err != nil {
+		return err
+	}
+	if err := os.Link(srcPath, dest); err == nil {
+		return nil
+	}
+	return copyFileContents(dest, srcPath, fi.Mode().Perm(), ws.copyBufSize)
+}
+
+// Clone creates an independent write set staged under tmpDir and copies the
+// currently staged contents into it, so several variants can be derived
+// from a common base without re-staging everything. On filesystems with
+// reflink support the copies share data blocks (FICLONE); otherwise a plain
+// copy is made. The clone reflects the staged state at the time of the
+// call, not writes made to either set afterwards.
+func (ws *WriteSet) Clone(tmpDir string) (*WriteSet, error) {
+	clone, err := NewWriteSet(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	clone.rootMode = ws.rootMode
+	err = filepath.WalkDir(ws.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ws.root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(clone.root, rel)
+		if d.IsDir() {
+			return os.Mkdir(target, fi.Mode().Perm())
+		}
+		return copyFileContents(target, path, fi.Mode().Perm(), clone.copyBufSize)
+	})
+	if err != nil {
+		clone.Cancel()
+		return nil, err
+	}
+	return clone, nil
+}
+
+// copyFileContents copies src to dst, preferring a reflink when the
+// filesystem supports it.
+func copyFileContents(dst, src string, perm os.FileMode, bufSize int) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if !cloneFile(df, sf) {
+		buf, release := getCopyBuf(bufSize)
+		_, err := io.CopyBuffer(df, sf, buf)
+		release()
+		if err != nil {
+			df.Close()
+			return err
+		}
+	}
+	return df.Close()
+}
+
+// Walk calls fn for every entry staged in the set, with a path relative to
+// the staging root, and stops at the first error. It is intended for
+// per-file follow-up work (registering in a database, computing digests)
+// before Commit, without a separate filepath.WalkDir pass over the
+// committed target.
+func (ws *WriteSet) Walk(fn func(relpath string, info os.FileInfo) error) error {
+	return filepath.WalkDir(ws.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(ws.root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(rel, fi)
+	})
+}
+
+// Verify hashes the staged files named in expected with SHA-256 and
+// compares them against the given raw digests, keyed by the names the
+// files were staged under. It returns an aggregated error naming every
+// mismatching and every missing file (nil when all match), so a corrupt
+// staging is caught before Commit makes it visible — a safety gate for
+// pipelines whose expected digests come from build caching. Staged files
+// not named in expected are ignored. Hashing uses the WithBufferSize
+// buffer and runs across WithConcurrency goroutines.
+func (ws *WriteSet) Verify(expected map[string][]byte) error {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	verify := func(name string) error {
+		if _, err := relStagingDir(ws.root, name); err != nil {
+			return err
+		}
+		sum, err := ws.hashStaged(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return errors.Errorf("%s: missing from staging", name)
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, expected[name]) {
+			return errors.Errorf("%s: digest mismatch: got %x, want %x", name, sum, expected[name])
+		}
+		return nil
+	}
+
+	results := make([]error, len(names))
+	if ws.concurrency <= 1 {
+		for i, name := range names {
+			results[i] = verify(name)
+		}
+	} else {
+		var wg sync.WaitGroup
+		jobs := make(chan int)
+		for range min(ws.concurrency, len(names)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					results[i] = verify(names[i])
+				}
+			}()
+		}
+		for i := range names {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+	}
+	return stderrors.Join(results...)
+}
+
+// hashStaged returns the SHA-256 digest of the staged file name.
+func (ws *WriteSet) hashStaged(name string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(ws.root, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	buf, release := getCopyBuf(ws.copyBufSize)
+	_, err = io.CopyBuffer(h, f, buf)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Cancel removes all files in the set without committing.
+func (ws *WriteSet) Cancel() error {
+	unregisterSet(ws.root)
+	return os.RemoveAll(ws.root)
+}
+
+// CommitError reports a commit that was interrupted partway through its
+// per-file copy, so the caller knows which files already reached the target.
+type CommitError struct {
+	// Committed holds the relative paths already copied to the target.
+	Committed []string
+	Err       error
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("commit interrupted after %d files: %v", len(e.Committed), e.Err)
+}
+
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// CommitContext is Commit with cancellation support. The whole-set rename
+// is instantaneous and merely checks ctx up front, but when the target is
+// on a different filesystem the commit degrades to a per-file copy, and ctx
+// is then checked between files; on cancellation a *CommitError describes
+// what was already copied. A partially-copied target is left in place for
+// inspection; the staged files remain intact either way.
+func (ws *WriteSet) CommitContext(ctx context.Context, target string) error {
+	target = rewritePath(target)
+	if err := checkCommitTarget(target); err != nil {
+		return err
+	}
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	if ws.rootMode != 0 {
+		if err := os.Chmod(ws.root, ws.rootMode); err != nil {
+			return err
+		}
+	}
+	err := ws.renameRoot(target)
+	if err == nil {
+		unregisterSet(ws.root)
+		return nil
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := ws.commitCopy(ctx, target); err != nil {
+		return err
+	}
+	unregisterSet(ws.root)
+	return os.RemoveAll(ws.root)
+}
+
+// commitCopy copies the staged tree to target file by file, checking ctx
+// between per-file operations. Directories are created up front in
+// parent-before-child order; file copies run across the goroutines
+// configured with WithConcurrency.
+func (ws *WriteSet) commitCopy(ctx context.Context, target string) error {
+	rootMode := ws.rootMode
+	if rootMode == 0 {
+		fi, err := os.Stat(ws.root)
+		if err != nil {
+			return err
+		}
+		rootMode = fi.Mode().Perm()
+	}
+	if err := os.Mkdir(target, rootMode); err != nil {
+		return err
+	}
+	type entry struct {
+		rel  string
+		perm os.FileMode
+	}
+	var dirs, files []entry
+	if err := ws.Walk(func(relpath string, info os.FileInfo) error {
+		if info.IsDir() {
+			dirs = append(dirs, entry{relpath, info.Mode().Perm()})
+		} else {
+			files = append(files, entry{relpath, info.Mode().Perm()})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// Walk yields parents before children, so creating the directories in
+	// order is safe regardless of how the file copies are scheduled
+	for _, d := range dirs {
+		if err := context.Cause(ctx); err != nil {
+			return &CommitError{Err: err}
+		}
+		if err := os.Mkdir(filepath.Join(target, d.rel), d.perm); err != nil {
+			return err
+		}
+	}
+	if ws.concurrency <= 1 {
+		var committed []string
+		for _, f := range files {
+			if err := context.Cause(ctx); err != nil {
+				return &CommitError{Committed: committed, Err: err}
+			}
+			if err := ws.doCopyFile(filepath.Join(target, f.rel), filepath.Join(ws.root, f.rel), f.perm); err != nil {
+				return &CommitError{Committed: committed, Err: err}
+			}
+			committed = append(committed, f.rel)
+		}
+		return nil
+	}
+	var (
+		mu        sync.Mutex
+		committed []string
+		firstErr  error
+		wg        sync.WaitGroup
+	)
+	jobs := make(chan entry)
+	for range ws.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+				err := ws.doCopyFile(filepath.Join(target, f.rel), filepath.Join(ws.root, f.rel), f.perm)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					committed = append(committed, f.rel)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+dispatch:
+	for _, f := range files {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case jobs <- f:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil {
+		firstErr = context.Cause(ctx)
+	}
+	if firstErr != nil {
+		return &CommitError{Committed: committed, Err: firstErr}
+	}
+	return nil
+}
+
+func (ws *WriteSet) doCopyFile(dst, src string, perm os.FileMode) error {
+	if ws.copyFile != nil {
+		return ws.copyFile(dst, src, perm)
+	}
+	return copyFileContents(dst, src, perm, ws.copyBufSize)
+}
+
+// Commit moves all staged files to the target directory. The target must
+// not exist. All files written to the set before calling Commit become
+// visible in the target directory at the same time.
+func (ws *WriteSet) Commit(target string) error {
+	target = rewritePath(target)
+	if err := checkCommitTarget(target); err != nil {
+		return err
+	}
+	if ws.rootMode != 0 {
+		if err := os.Chmod(ws.root, ws.rootMode); err != nil {
+			return err
+		}
+	}
+	if err := ws.renameRoot(target); err != nil {
+		return err
+	}
+	unregisterSet(ws.root)
+	return nil
+}
+
+// CommitMerge atomically replaces an existing target directory with the
+// set's contents while carrying forward the entries listed in keep from
+// the current target — e.g. a .git directory or a cache the new tree
+// should retain. The kept paths (relative to target) are first pulled into
+// the staging root, reflink-cloned when the filesystem supports it, and
+// then the staging root and the target are swapped in a single
+// RENAME_EXCHANGE, so readers see either the complete old tree or the
+// complete merged new tree. The old tree is removed after the swap.
+//
+// The exchange is Linux-only and, like every rename in this package,
+// requires the staging root and the target on the same filesystem. Keep
+// entries missing from the target are ignored; a keep entry colliding with
+// staged content fails the commit before anything becomes visible. A
+// missing target degrades to a plain Commit.
+func (ws *WriteSet) CommitMerge(target string, keep []string) error {
+	target = rewritePath(target)
+	if err := checkCommitTarget(target); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+		return ws.Commit(target)
+	} else if err != nil {
+		return err
+	}
+	for _, name := range keep {
+		if err := ws.keepExisting(target, name); err != nil {
+			return err
+		}
+	}
+	if ws.rootMode != 0 {
+		if err := os.Chmod(ws.root, ws.rootMode); err != nil {
+			return err
+		}
+	}
+	err := renameExchange(ws.root, target)
+	for i := 0; i < ws.renameRetries && errors.Is(err, syscall.EBUSY); i++ {
+		time.Sleep(ws.renameBackoff)
+		err = renameExchange(ws.root, target)
+	}
+	if err != nil {
+		return err
+	}
+	unregisterSet(ws.root)
+	// the old tree now sits under the staging root and has served its
+	// purpose
+	return os.RemoveAll(ws.root)
+}
+
+// keepExisting pulls the target's entry name (a file, symlink or directory
+// tree) into the staging root.
+func (ws *WriteSet) keepExisting(target, name string) error {
+	src := filepath.Join(target, name)
+	fi, err := os.Lstat(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := ws.mkdirParents(name); err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode().IsRegular():
+		return ws.AddExisting(name, src)
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return ws.keepSymlink(name, src)
+	case fi.IsDir():
+		return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(target, path)
+			if err != nil {
+				return err
+			}
+			switch {
+			case d.IsDir():
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return os.MkdirAll(filepath.Join(ws.root, rel), info.Mode().Perm())
+			case d.Type()&fs.ModeSymlink != 0:
+				return ws.keepSymlink(rel, path)
+			default:
+				return ws.AddExisting(rel, path)
+			}
+		})
+	default:
+		return errors.Errorf("cannot keep %s: unsupported file type %s", name, fi.Mode().Type())
+	}
+}
+
+// keepSymlink recreates the symlink src as name inside the staging root.
+func (ws *WriteSet) keepSymlink(name, src string) error {
+	dest, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(dest, filepath.Join(ws.root, name))
+}
+
+// renameRoot renames the staging root to target, retrying transient EBUSY
+// per WithCommitRetry.
+func (ws *WriteSet) renameRoot(target string) error {
+	err := os.Rename(ws.root, target)
+	for i := 0; i < ws.renameRetries && errors.Is(err, syscall.EBUSY); i++ {
+		time.Sleep(ws.renameBackoff)
+		err = os.Rename(ws.root, target)
+	}
+	return err
+}
+
+// String returns the location the set is staged in.
+func (ws *WriteSet) String() string {
+	return ws.root
+}
@@ -0,0 +1,515 @@
+package atomicwriter
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSet(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+	require.NoError(t, ws.WriteFile("b.txt", []byte("bbb"), 0o600))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ws.Commit(target))
+
+	dt, err := os.ReadFile(filepath.Join(target, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "aaa", string(dt))
+
+	dt, err = os.ReadFile(filepath.Join(target, "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "bbb", string(dt))
+}
+
+func TestWriteSetCancel(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+	require.NoError(t, ws.Cancel())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestWriteSetCommitIntoLiveSet(t *testing.T) {
+	dir := t.TempDir()
+
+	ws1, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws1.Cancel()
+
+	ws2, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws2.Cancel()
+
+	require.NoError(t, ws1.WriteFile("a.txt", []byte("aaa"), 0o644))
+
+	err = ws1.Commit(ws1.String())
+	require.ErrorContains(t, err, "staging root of a live write set")
+
+	err = ws1.Commit(filepath.Join(ws2.String(), "sub"))
+	require.ErrorContains(t, err, "inside the staging root of a live write set")
+
+	// a valid target still works
+	require.NoError(t, ws1.Commit(filepath.Join(dir, "target")))
+}
+
+func TestWriteSetClone(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("base.txt", []byte("base"), 0o644))
+
+	clone, err := ws.Clone(dir)
+	require.NoError(t, err)
+
+	// mutating the clone does not affect the base and vice versa
+	require.NoError(t, clone.WriteFile("base.txt", []byte("variant"), 0o644))
+	require.NoError(t, ws.WriteFile("only-base.txt", []byte("x"), 0o644))
+
+	baseTarget := filepath.Join(dir, "base-target")
+	require.NoError(t, ws.Commit(baseTarget))
+	cloneTarget := filepath.Join(dir, "clone-target")
+	require.NoError(t, clone.Commit(cloneTarget))
+
+	dt, err := os.ReadFile(filepath.Join(baseTarget, "base.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "base", string(dt))
+
+	dt, err = os.ReadFile(filepath.Join(cloneTarget, "base.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "variant", string(dt))
+
+	_, err = os.Stat(filepath.Join(cloneTarget, "only-base.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriteSetDirMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir, WithDirMode(0o750), WithDirOwner(os.Getuid(), os.Getgid()))
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile(filepath.Join("etc", "conf.d", "app.conf"), []byte("cfg"), 0o644))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ws.Commit(target))
+
+	for _, sub := range []string{"etc", filepath.Join("etc", "conf.d")} {
+		fi, err := os.Stat(filepath.Join(target, sub))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o750), fi.Mode().Perm(), sub)
+	}
+
+	dt, err := os.ReadFile(filepath.Join(target, "etc", "conf.d", "app.conf"))
+	require.NoError(t, err)
+	require.Equal(t, "cfg", string(dt))
+}
+
+func TestWriteSetEscape(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+
+	err = ws.WriteFile(filepath.Join("..", "escape.txt"), []byte("x"), 0o644)
+	require.ErrorContains(t, err, "escapes the staging root")
+}
+
+func TestWriteSetWalk(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+	require.NoError(t, ws.WriteFile(filepath.Join("sub", "b.txt"), []byte("bb"), 0o644))
+
+	seen := map[string]int64{}
+	err = ws.Walk(func(relpath string, info os.FileInfo) error {
+		if !info.IsDir() {
+			seen[filepath.ToSlash(relpath)] = info.Size()
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{"a.txt": 3, "sub/b.txt": 2}, seen)
+
+	err = ws.Walk(func(relpath string, info os.FileInfo) error {
+		return errors.New("stop")
+	})
+	require.ErrorContains(t, err, "stop")
+}
+
+func TestOpenWriteSet(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+	root := ws.String()
+	unregisterSet(root) // simulate the original process going away
+
+	resumed, err := OpenWriteSet(root)
+	require.NoError(t, err)
+	require.NoError(t, resumed.WriteFile("b.txt", []byte("bbb"), 0o644))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, resumed.Commit(target))
+
+	for name, want := range map[string]string{"a.txt": "aaa", "b.txt": "bbb"} {
+		dt, err := os.ReadFile(filepath.Join(target, name))
+		require.NoError(t, err)
+		require.Equal(t, want, string(dt))
+	}
+
+	_, err = OpenWriteSet(filepath.Join(dir, "missing"))
+	require.ErrorContains(t, err, "invalid staging root")
+
+	plain := filepath.Join(dir, "plain")
+	require.NoError(t, os.Mkdir(plain, 0o755))
+	_, err = OpenWriteSet(plain)
+	require.ErrorContains(t, err, "does not look like a staging root")
+}
+
+func TestWriteSetConcurrentMkdir(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+
+	// many goroutines race to create files in a shared new subtree
+	var wg sync.WaitGroup
+	errCh := make(chan error, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := filepath.Join("shared", "nested", fmt.Sprintf("f-%d.txt", i))
+			errCh <- ws.WriteFile(name, []byte("x"), 0o644)
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		require.NoError(t, err)
+	}
+
+	var files int
+	require.NoError(t, ws.Walk(func(relpath string, info os.FileInfo) error {
+		if !info.IsDir() {
+			files++
+		}
+		return nil
+	}))
+	require.Equal(t, 64, files)
+}
+
+func TestWriteSetMkdirOverFile(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+
+	// an entry with the parent's name already exists as a file
+	require.NoError(t, ws.WriteFile("clash", []byte("x"), 0o644))
+	err = ws.WriteFile(filepath.Join("clash", "child.txt"), []byte("x"), 0o644)
+	require.ErrorContains(t, err, "is not a directory")
+}
+
+func TestWriteSetRootMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not fully supported on windows")
+	}
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir, WithRootMode(0o755))
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ws.Commit(target))
+
+	fi, err := os.Stat(target)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+}
+
+func TestWriteSetCommitContext(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+
+	// a cancelled context stops the commit before anything happens
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(nil)
+	err = ws.CommitContext(ctx, filepath.Join(dir, "target"))
+	require.ErrorIs(t, err, context.Canceled)
+
+	// the fast same-filesystem rename path still works
+	require.NoError(t, ws.CommitContext(context.Background(), filepath.Join(dir, "target")))
+	dt, err := os.ReadFile(filepath.Join(dir, "target", "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "aaa", string(dt))
+}
+
+func TestWriteSetCommitCopy(t *testing.T) {
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+	require.NoError(t, ws.WriteFile("a.txt", []byte("aaa"), 0o644))
+	require.NoError(t, ws.WriteFile(filepath.Join("sub", "b.txt"), []byte("bb"), 0o600))
+
+	// the copy fallback used for cross-filesystem targets
+	target := filepath.Join(dir, "copied")
+	require.NoError(t, ws.commitCopy(context.Background(), target))
+	dt, err := os.ReadFile(filepath.Join(target, "sub", "b.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "bb", string(dt))
+
+	// cancellation partway is reported as a *CommitError
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(nil)
+	err = ws.commitCopy(ctx, filepath.Join(dir, "cancelled"))
+	var ce *CommitError
+	require.ErrorAs(t, err, &ce)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Empty(t, ce.Committed)
+}
+
+func TestWriteSetAddExisting(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "large.bin")
+	require.NoError(t, os.WriteFile(src, []byte("existing content"), 0o640))
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.AddExisting(filepath.Join("sub", "large.bin"), src))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ws.Commit(target))
+
+	dt, err := os.ReadFile(filepath.Join(target, "sub", "large.bin"))
+	require.NoError(t, err)
+	require.Equal(t, "existing content", string(dt))
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(filepath.Join(target, "sub", "large.bin"))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+	}
+
+	ws, err = NewWriteSet(dir)
+	require.NoError(t, err)
+	defer ws.Cancel()
+	err = ws.AddExisting(filepath.Join("..", "escape.bin"), src)
+	require.ErrorContains(t, err, "escapes the staging root")
+	err = ws.AddExisting("dir.bin", dir)
+	require.ErrorContains(t, err, "not a regular file")
+}
+
+func TestWriteSetCommitCopyConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWriteSet(dir, WithConcurrency(4))
+	require.NoError(t, err)
+	for i := range 20 {
+		require.NoError(t, ws.WriteFile(fmt.Sprintf("sub%d/file%d.txt", i%3, i), []byte(fmt.Sprintf("content %d", i)), 0o644))
+	}
+	target := filepath.Join(dir, "out")
+	require.NoError(t, ws.commitCopy(context.Background(), target))
+	for i := range 20 {
+		dt, err := os.ReadFile(filepath.Join(target, fmt.Sprintf("sub%d/file%d.txt", i%3, i)))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("content %d", i), string(dt))
+	}
+	require.NoError(t, ws.Cancel())
+}
+
+func TestWriteSetCommitCopyConcurrentError(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWriteSet(dir, WithConcurrency(4))
+	require.NoError(t, err)
+	for i := range 10 {
+		require.NoError(t, ws.WriteFile(fmt.Sprintf("file%d.txt", i), []byte("x"), 0o644))
+	}
+	copyErr := errors.New("copy failed")
+	var calls atomic.Int64
+	ws.copyFile = func(dst, src string, perm os.FileMode) error {
+		if calls.Add(1) == 3 {
+			return copyErr
+		}
+		return copyFileContents(dst, src, perm, 0)
+	}
+	err = ws.commitCopy(context.Background(), filepath.Join(dir, "out"))
+	var cerr *CommitError
+	require.ErrorAs(t, err, &cerr)
+	require.ErrorIs(t, cerr.Err, copyErr)
+	// everything reported as committed actually landed
+	for _, rel := range cerr.Committed {
+		_, serr := os.Stat(filepath.Join(dir, "out", rel))
+		require.NoError(t, serr)
+	}
+	require.NoError(t, ws.Cancel())
+}
+
+func BenchmarkCommitCopy(b *testing.B) {
+	// a simulated high-latency filesystem: every per-file copy pays a fixed
+	// round-trip before doing the real work
+	const latency = 200 * time.Microsecond
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("concurrency-%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := b.TempDir()
+				ws, err := NewWriteSet(dir, WithConcurrency(workers))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for i := range 64 {
+					if err := ws.WriteFile(fmt.Sprintf("file%d.txt", i), []byte("content"), 0o644); err != nil {
+						b.Fatal(err)
+					}
+				}
+				ws.copyFile = func(dst, src string, perm os.FileMode) error {
+					time.Sleep(latency)
+					return copyFileContents(dst, src, perm, 0)
+				}
+				b.StartTimer()
+				if err := ws.commitCopy(context.Background(), filepath.Join(dir, "out")); err != nil {
+					b.Fatal(err)
+				}
+				b.StopTimer()
+				if err := ws.Cancel(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSetCommitMerge(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("RENAME_EXCHANGE requires linux")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "checkout")
+
+	// existing tree: a stale file plus entries worth keeping
+	require.NoError(t, os.MkdirAll(filepath.Join(target, ".git", "refs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(target, ".git", "HEAD"), []byte("ref: main"), 0o644))
+	require.NoError(t, os.Symlink("HEAD", filepath.Join(target, ".git", "link")))
+	require.NoError(t, os.WriteFile(filepath.Join(target, "stale.txt"), []byte("old"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(target, "cache"), []byte("warm"), 0o600))
+
+	ws, err := NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("main.go", []byte("package main"), 0o644))
+	root := ws.String()
+
+	require.NoError(t, ws.CommitMerge(target, []string{".git", "cache", "missing"}))
+
+	// the new tree with the kept entries, the stale file gone
+	dt, err := os.ReadFile(filepath.Join(target, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main", string(dt))
+	_, err = os.Stat(filepath.Join(target, "stale.txt"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	dt, err = os.ReadFile(filepath.Join(target, ".git", "HEAD"))
+	require.NoError(t, err)
+	require.Equal(t, "ref: main", string(dt))
+	link, err := os.Readlink(filepath.Join(target, ".git", "link"))
+	require.NoError(t, err)
+	require.Equal(t, "HEAD", link)
+	dt, err = os.ReadFile(filepath.Join(target, "cache"))
+	require.NoError(t, err)
+	require.Equal(t, "warm", string(dt))
+	_, err = os.Stat(filepath.Join(target, ".git", "refs"))
+	require.NoError(t, err)
+
+	// the old tree is cleaned up after the swap
+	_, err = os.Stat(root)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// a keep entry colliding with staged content fails before the swap
+	ws, err = NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("cache", []byte("fresh"), 0o644))
+	require.Error(t, ws.CommitMerge(target, []string{"cache"}))
+	dt, err = os.ReadFile(filepath.Join(target, "cache"))
+	require.NoError(t, err)
+	require.Equal(t, "warm", string(dt))
+	require.NoError(t, ws.Cancel())
+
+	// a missing target degrades to a plain Commit
+	ws, err = NewWriteSet(dir)
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile("a", []byte("a"), 0o644))
+	fresh := filepath.Join(dir, "fresh")
+	require.NoError(t, ws.CommitMerge(fresh, []string{".git"}))
+	dt, err = os.ReadFile(filepath.Join(fresh, "a"))
+	require.NoError(t, err)
+	require.Equal(t, "a", string(dt))
+}
+
+func TestWriteSetVerify(t *testing.T) {
+	dir := t.TempDir()
+	ws, err := NewWriteSet(dir, WithConcurrency(4), WithBufferSize(64<<10))
+	require.NoError(t, err)
+	defer ws.Cancel()
+
+	require.NoError(t, ws.WriteFile("a.txt", []byte("alpha"), 0o644))
+	require.NoError(t, ws.WriteFile(filepath.Join("sub", "b.txt"), []byte("beta"), 0o644))
+
+	digest := func(dt []byte) []byte {
+		sum := sha256.Sum256(dt)
+		return sum[:]
+	}
+	require.NoError(t, ws.Verify(map[string][]byte{
+		"a.txt":                       digest([]byte("alpha")),
+		filepath.Join("sub", "b.txt"): digest([]byte("beta")),
+	}))
+
+	// mismatches and missing files are all reported in one error
+	err = ws.Verify(map[string][]byte{
+		"a.txt":                       digest([]byte("alpha")),
+		filepath.Join("sub", "b.txt"): digest([]byte("corrupted")),
+		"gone.txt":                    digest([]byte("gone")),
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), filepath.Join("sub", "b.txt")+": digest mismatch")
+	require.Contains(t, err.Error(), "gone.txt: missing from staging")
+	require.NotContains(t, err.Error(), "a.txt")
+
+	// names may not escape the staging root
+	err = ws.Verify(map[string][]byte{filepath.Join("..", "evil"): digest(nil)})
+	require.ErrorContains(t, err, "escapes the staging root")
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package atomicwriter
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSetWithUmask(t *testing.T) {
+	// the process umask must not leak into the result either way
+	old := syscall.Umask(0o027)
+	defer syscall.Umask(old)
+
+	dir := t.TempDir()
+
+	ws, err := NewWriteSet(dir, WithDirMode(0o777), WithUmask(0o022))
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile(filepath.Join("a", "b", "f.txt"), []byte("x"), 0o644))
+
+	target := filepath.Join(dir, "target")
+	require.NoError(t, ws.Commit(target))
+
+	for _, sub := range []string{"a", filepath.Join("a", "b")} {
+		fi, err := os.Stat(filepath.Join(target, sub))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o755), fi.Mode().Perm(), sub)
+	}
+
+	// without WithUmask the configured dir mode applies verbatim
+	ws, err = NewWriteSet(dir, WithDirMode(0o777))
+	require.NoError(t, err)
+	require.NoError(t, ws.WriteFile(filepath.Join("c", "f.txt"), []byte("x"), 0o644))
+	target2 := filepath.Join(dir, "target2")
+	require.NoError(t, ws.Commit(target2))
+	fi, err := os.Stat(filepath.Join(target2, "c"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o777), fi.Mode().Perm())
+}